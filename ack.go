@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ackLine is the line -ack-file must hold to acknowledge the terms of
+// service of the scraped site
+const ackLine = "I have read the StockTwits terms of service and am permitted to scrape it for this use"
+
+// checkAcknowledgement fails unless the file name holds ackLine. It gates
+// every mode sending requests to the site, the in-process -bench and
+// -selftest servers excepted.
+func checkAcknowledgement(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("terms of service not acknowledged: %s", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == ackLine {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("terms of service not acknowledged: %s", err)
+	}
+	return fmt.Errorf("terms of service not acknowledged: %s does not hold the line %q", name, ackLine)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeAck(t *testing.T, content string) string {
+	name := filepath.Join(t.TempDir(), "ack.txt")
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestCheckAcknowledgement(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		ok   bool
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "absent.txt"), false},
+		{"empty file", writeAck(t, ""), false},
+		{"line among others", writeAck(t, "Signed by the compliance team\r\n  "+ackLine+"  \r\n2024-01-02\r\n"), true},
+		{"line altered", writeAck(t, strings.Replace(ackLine, "permitted", "allowed", 1)+"\n"), false},
+		{"line cut", writeAck(t, ackLine[:len(ackLine)/2]), false},
+		{"binary garbage", writeAck(t, "\x00\xff\xfe"+strings.Repeat("\x01", 100)), false},
+		{"directory", t.TempDir(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAcknowledgement(tt.file)
+			if tt.ok && err != nil {
+				t.Fatalf("checkAcknowledgement = %s, want it acknowledged", err)
+			}
+			if !tt.ok && (err == nil || !strings.Contains(err.Error(), "not acknowledged")) {
+				t.Fatalf("checkAcknowledgement = %v, want it refused", err)
+			}
+		})
+	}
+}
+
+// TestAcknowledgementGatesEveryMode runs each entry point of run with an
+// acknowledgement that is missing or wrong: the modes sending requests
+// must stop before creating any output, the others must not be held back.
+func TestAcknowledgementGatesEveryMode(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "absent.txt")
+	wrong := writeAck(t, "I agree\n")
+	valid := writeAck(t, ackLine+"\n")
+	watchlist := filepath.Join(t.TempDir(), "watchlist.csv")
+	if err := os.WriteFile(watchlist, []byte("Symbol\nMSFT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resumeDir := t.TempDir()
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"scrape", []string{"-ack-file", missing}, exitUsage},
+		{"scrape with a wrong line", []string{"-ack-file", wrong}, exitUsage},
+		{"conversation", []string{"-ack-file", wrong, "-conversation", "42"}, exitUsage},
+		{"import watchlist", []string{"-ack-file", wrong, "-import-watchlist", watchlist}, exitUsage},
+		{"resume all", []string{"-ack-file", missing, "-resume-all", resumeDir}, exitUsage},
+		{"validate only", []string{"-ack-file", wrong, "-validate-only"}, exitError},
+		{"validate only acknowledged", []string{"-ack-file", valid, "-validate-only"}, exitComplete},
+		{"selftest is local", []string{"-ack-file", missing, "-selftest"}, exitComplete},
+		{"convert is local", []string{"-ack-file", missing, "-convert", "in.csv", "-convert-out", "out.jsonl"}, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			// nothing listens there, should a request escape the gate
+			args := append([]string{"-base-url", "http://127.0.0.1:1", "-retry", "0", "-log-file", os.DevNull}, tt.args...)
+			withArgs(t, args, func() {
+				if code := run(); code != tt.want {
+					t.Fatalf("run %s = %d, want %d", strings.Join(tt.args, " "), code, tt.want)
+				}
+			})
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				if tt.want == exitUsage || strings.HasSuffix(e.Name(), ".csv") {
+					t.Errorf("%s left %s behind", tt.name, e.Name())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// aggregateBuckets maps an -aggregate value to the truncation of a row's time to its bucket
+var aggregateBuckets = map[string]func(time.Time) time.Time{
+	"hour": func(t time.Time) time.Time { return t.Truncate(time.Hour) },
+	"day": func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	},
+}
+
+// sentimentBucket counts the rows created within one bucket
+type sentimentBucket struct {
+	bullish, bearish, neutral int
+	likes                     int64
+}
+
+// aggregateOutput counts the rows of the output file fName per bucket of
+// their CreatedAt and replaces aggName with the counts, oldest bucket first.
+// Reading the whole output file makes the counts include earlier runs.
+// Times are bucketed in loc, whatever offset the rows were written with.
+func aggregateOutput(fName, aggName, bucket string, loc *time.Location) error {
+	truncate := aggregateBuckets[bucket]
+	file, err := os.Open(fName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	// skips the #schema line
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	buckets := map[time.Time]*sentimentBucket{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// the header and any unparsable row are skipped
+		if len(row) < 5 {
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339, row[1])
+		if err != nil {
+			continue
+		}
+		key := truncate(createdAt.In(loc))
+		b := buckets[key]
+		if b == nil {
+			b = &sentimentBucket{}
+			buckets[key] = b
+		}
+		switch row[3] {
+		case "Bullish":
+			b.bullish++
+		case "Bearish":
+			b.bearish++
+		default:
+			b.neutral++
+		}
+		likes, _ := strconv.ParseInt(row[4], 10, 64)
+		b.likes += likes
+	}
+
+	keys := make([]time.Time, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Before(keys[j]) })
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = '\t'
+	writer.Write([]string{"Bucket", "Bullish", "Bearish", "Neutral", "Total", "Likes"})
+	for _, key := range keys {
+		b := buckets[key]
+		writer.Write([]string{key.Format(time.RFC3339),
+			strconv.Itoa(b.bullish), strconv.Itoa(b.bearish), strconv.Itoa(b.neutral),
+			strconv.Itoa(b.bullish + b.bearish + b.neutral), strconv.FormatInt(b.likes, 10)})
+	}
+	writer.Flush()
+	tmp := aggName + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, aggName)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// anomalyWindow is the number of recent batches the moving range covers
+	anomalyWindow = 20
+	// anomalyMinBatches is the number of batches seen before ranges are checked
+	anomalyMinBatches = 5
+	// anomalyFactor is how far outside the moving range a batch may go
+	anomalyFactor = 2
+)
+
+// batchStats keeps the message counts and response sizes of a stream's
+// recent batches, to catch batches that look nothing like the ones before,
+// such as a renamed field decoding into empty bodies.
+type batchStats struct {
+	counts []int
+	sizes  []int
+}
+
+// observe checks a batch against the moving range and then records it.
+// The last batch of a stream is usually short, so only its bodies are checked.
+func (s *batchStats) observe(msgs []Message, size int, last bool) []string {
+	var anomalies []string
+	empty := 0
+	for _, msg := range msgs {
+		if strings.TrimSpace(msg.Body) == "" {
+			empty++
+		}
+	}
+	if len(msgs) > 0 && empty == len(msgs) {
+		anomalies = append(anomalies, fmt.Sprintf("all %d message bodies are empty", len(msgs)))
+	}
+	if !last && len(s.counts) >= anomalyMinBatches {
+		if lo, hi := movingRange(s.counts); len(msgs) < lo/anomalyFactor || len(msgs) > hi*anomalyFactor {
+			anomalies = append(anomalies, fmt.Sprintf("%d messages, recent batches had %d - %d", len(msgs), lo, hi))
+		}
+		if lo, hi := movingRange(s.sizes); size < lo/anomalyFactor || size > hi*anomalyFactor {
+			anomalies = append(anomalies, fmt.Sprintf("%d response bytes, recent batches had %d - %d", size, lo, hi))
+		}
+	}
+	s.counts = append(s.counts, len(msgs))
+	s.sizes = append(s.sizes, size)
+	if len(s.counts) > anomalyWindow {
+		s.counts = s.counts[1:]
+		s.sizes = s.sizes[1:]
+	}
+	return anomalies
+}
+
+// movingRange returns the smallest and largest of values
+func movingRange(values []int) (int, int) {
+	lo, hi := values[0], values[0]
+	for _, v := range values[1:] {
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+	return lo, hi
+}
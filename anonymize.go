@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mentionPattern matches an @mention in a message body
+var mentionPattern = regexp.MustCompile(`@[A-Za-z0-9_]+`)
+
+// anonymizer replaces user identities with pseudonyms derived by HMAC
+// from a key, so an account maps to the same pseudonym in every run
+// with that key and cannot be recovered without it.
+type anonymizer struct {
+	key []byte
+}
+
+func (a *anonymizer) sum(kind, value string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind + ":" + value))
+	return mac.Sum(nil)
+}
+
+// username returns the pseudonym of a username, which is case-insensitive
+func (a *anonymizer) username(name string) string {
+	return "user_" + hex.EncodeToString(a.sum("username", strings.ToLower(name))[:6])
+}
+
+// userID returns the positive pseudonym of a user ID
+func (a *anonymizer) userID(id int64) int64 {
+	return int64(binary.BigEndian.Uint64(a.sum("id", strconv.FormatInt(id, 10))) >> 1)
+}
+
+// message pseudonymizes the author and the mentions in the body of m
+func (a *anonymizer) message(m *Message) {
+	m.User.ID = a.userID(m.User.ID)
+	m.User.Username = a.username(m.User.Username)
+	m.Body = mentionPattern.ReplaceAllStringFunc(m.Body, func(mention string) string {
+		return "@" + a.username(mention[1:])
+	})
+}
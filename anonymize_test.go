@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizerIsStable(t *testing.T) {
+	a, again := &anonymizer{key: []byte("k1")}, &anonymizer{key: []byte("k1")}
+	other := &anonymizer{key: []byte("k2")}
+	// the same key gives the same pseudonyms, as in a later run
+	if a.username("trader42") != again.username("trader42") || a.userID(42) != again.userID(42) {
+		t.Fatal("pseudonyms differ between anonymizers with the same key")
+	}
+	if a.username("Trader42") != a.username("trader42") {
+		t.Fatal("usernames are case-insensitive, their pseudonyms must be too")
+	}
+	if a.username("trader42") == other.username("trader42") || a.userID(42) == other.userID(42) {
+		t.Fatal("another key gives the same pseudonyms")
+	}
+	names, ids := map[string]bool{}, map[int64]bool{}
+	for i := int64(1); i <= 1000; i++ {
+		names[a.username("trader"+strconv.FormatInt(i, 10))] = true
+		id := a.userID(i)
+		if id <= 0 {
+			t.Fatalf("userID(%d) = %d, want a positive ID", i, id)
+		}
+		ids[id] = true
+	}
+	if len(names) != 1000 || len(ids) != 1000 {
+		t.Fatalf("%d usernames and %d IDs for 1000 users, want distinct pseudonyms", len(names), len(ids))
+	}
+}
+
+func TestAnonymizerRemovesIdentities(t *testing.T) {
+	a := &anonymizer{key: []byte("secret")}
+	var m Message
+	m.User.ID, m.User.Username = 987654, "BullTrader"
+	m.Body = "@bulltrader @Bear_Cub and @x9 see $AAPL, mail me at me@example.com"
+	a.message(&m)
+	for _, raw := range []string{"BullTrader", "bulltrader", "Bear_Cub", "@x9 ", "987654"} {
+		if strings.Contains(m.Body, raw) || strings.Contains(m.User.Username, raw) || strconv.FormatInt(m.User.ID, 10) == raw {
+			t.Fatalf("%q left in %+v", raw, m)
+		}
+	}
+	if m.User.Username != a.username("BullTrader") || m.User.ID != a.userID(987654) {
+		t.Fatalf("author is %q %d, want the pseudonyms", m.User.Username, m.User.ID)
+	}
+	// a mention of the author reads as the author's pseudonym
+	if want := "@" + a.username("bulltrader") + " @" + a.username("bear_cub"); !strings.HasPrefix(m.Body, want) {
+		t.Fatalf("body %q does not start with %q", m.Body, want)
+	}
+	if !strings.Contains(m.Body, "$AAPL") {
+		t.Fatalf("cashtag lost in %q", m.Body)
+	}
+}
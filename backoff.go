@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// JitterStrategy randomizes a wait drawing from rnd. base is the attempt's
+// wait before jitter and prev the wait returned for the previous attempt.
+type JitterStrategy func(rnd *rand.Rand, base, prev time.Duration) time.Duration
+
+// noJitter waits exactly base, retries of many clients stay in lockstep
+func noJitter(rnd *rand.Rand, base, prev time.Duration) time.Duration {
+	return base
+}
+
+// fullJitter waits uniformly in [0, base], spreading retries the most
+// but sometimes hardly waiting at all
+func fullJitter(rnd *rand.Rand, base, prev time.Duration) time.Duration {
+	return time.Duration(rnd.Int63n(int64(base) + 1))
+}
+
+// equalJitter waits base/2 plus uniformly [0, base/2], keeping a minimum wait
+func equalJitter(rnd *rand.Rand, base, prev time.Duration) time.Duration {
+	return base/2 + time.Duration(rnd.Int63n(int64(base/2)+1))
+}
+
+// decorrelatedJitter waits uniformly between base and 3 times the previous wait,
+// growing on its own, so it is meant for a backoff with Factor 1
+func decorrelatedJitter(rnd *rand.Rand, base, prev time.Duration) time.Duration {
+	if prev < base {
+		prev = base
+	}
+	return base + time.Duration(rnd.Int63n(int64(3*prev-base)+1))
+}
+
+// jitterStrategies are the -jitter-strategy values
+var jitterStrategies = map[string]JitterStrategy{
+	"none":         noJitter,
+	"full":         fullJitter,
+	"equal":        equalJitter,
+	"decorrelated": decorrelatedJitter,
+}
+
+// newRetryBackoff returns the backoff for failed requests with the named jitter strategy
+func newRetryBackoff(strategy string, rnd *rand.Rand) (*backoff, error) {
+	jitter, ok := jitterStrategies[strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown jitter strategy %q", strategy)
+	}
+	// 1s, 2s, 4s ... up to a minute before jitter
+	b := &backoff{Base: time.Second, Max: time.Minute, Factor: 2, Jitter: jitter, Rand: rnd}
+	if strategy == "decorrelated" {
+		b.Factor = 1
+	}
+	return b, nil
+}
+
+// backoff computes waits growing by Factor from Base up to Max,
+// randomized by Jitter if set. It is safe for concurrent use.
+type backoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Factor float64
+	Jitter JitterStrategy
+	// Rand is the source of Jitter, guarded by mutex
+	Rand *rand.Rand
+
+	mutex   sync.Mutex
+	attempt int
+	prev    time.Duration
+}
+
+// Next returns the wait before the next attempt and advances the attempt count.
+func (b *backoff) Next() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	// clamped as a float, converting a wait past Max or past the largest
+	// Duration after some 34 doublings would overflow to a negative one
+	grown := float64(b.Base) * math.Pow(b.Factor, float64(b.attempt))
+	var wait time.Duration
+	switch {
+	case b.Max > 0 && grown >= float64(b.Max):
+		wait = b.Max
+	case grown >= math.MaxInt64:
+		wait = math.MaxInt64
+	default:
+		wait = time.Duration(grown)
+	}
+	b.attempt++
+	if b.Jitter != nil && wait > 0 {
+		wait = b.Jitter(b.Rand, wait, b.prev)
+		if b.Max > 0 && wait > b.Max {
+			wait = b.Max
+		}
+	}
+	b.prev = wait
+	return wait
+}
+
+// clone returns a backoff with the same settings at its first attempt,
+// drawing from its own source seeded by b's
+func (b *backoff) clone() *backoff {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	c := &backoff{Base: b.Base, Max: b.Max, Factor: b.Factor, Jitter: b.Jitter}
+	if b.Rand != nil {
+		c.Rand = rand.New(rand.NewSource(b.Rand.Int63()))
+	}
+	return c
+}
+
+// Reset starts again from Base, e.g. after a successful request.
+func (b *backoff) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.attempt = 0
+	b.prev = 0
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestBackoffGrowth(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *backoff
+		want []time.Duration
+	}{
+		{"doubling", &backoff{Base: time.Second, Max: time.Minute, Factor: 2},
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second}},
+		{"clamped to max", &backoff{Base: 10 * time.Second, Max: 25 * time.Second, Factor: 2},
+			[]time.Duration{10 * time.Second, 20 * time.Second, 25 * time.Second, 25 * time.Second}},
+		{"constant", &backoff{Base: 500 * time.Millisecond, Max: 500 * time.Millisecond, Factor: 1},
+			[]time.Duration{500 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond}},
+		{"no max", &backoff{Base: time.Millisecond, Factor: 3},
+			[]time.Duration{time.Millisecond, 3 * time.Millisecond, 9 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := tt.b.Next(); got != want {
+					t.Fatalf("attempt %d: got %s, want %s", i, got, want)
+				}
+			}
+			tt.b.Reset()
+			if got := tt.b.Next(); got != tt.want[0] {
+				t.Errorf("after Reset: got %s, want %s", got, tt.want[0])
+			}
+		})
+	}
+}
+
+func TestBackoffLargeAttempts(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *backoff
+		want time.Duration
+	}{
+		{"max", &backoff{Base: time.Second, Max: time.Minute, Factor: 2}, time.Minute},
+		{"no max", &backoff{Base: time.Second, Factor: 2}, time.Duration(1<<63 - 1)},
+		{"jittered", &backoff{Base: time.Second, Max: time.Minute, Factor: 2, Jitter: equalJitter, Rand: rand.New(rand.NewSource(1))}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 2000; i++ {
+				got := tt.b.Next()
+				if got <= 0 {
+					t.Fatalf("attempt %d: got %s, want a positive wait", i, got)
+				}
+				if tt.b.Max > 0 && got > tt.b.Max {
+					t.Fatalf("attempt %d: got %s above max %s", i, got, tt.b.Max)
+				}
+				if tt.want != 0 && i >= 100 && got != tt.want {
+					t.Fatalf("attempt %d: got %s, want %s", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	const base = 8 * time.Second
+	tests := []struct {
+		name     string
+		jitter   JitterStrategy
+		prev     time.Duration
+		min, max time.Duration
+	}{
+		{"none", noJitter, 0, base, base},
+		{"full", fullJitter, 0, 0, base},
+		{"equal", equalJitter, 0, base / 2, base},
+		{"decorrelated first", decorrelatedJitter, 0, base, 3 * base},
+		{"decorrelated grown", decorrelatedJitter, 20 * time.Second, base, 60 * time.Second},
+	}
+	rnd := rand.New(rand.NewSource(7))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				if got := tt.jitter(rnd, base, tt.prev); got < tt.min || got > tt.max {
+					t.Fatalf("got %s, want within [%s, %s]", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryBackoffStaysUnderMax(t *testing.T) {
+	for strategy := range jitterStrategies {
+		b, err := newRetryBackoff(strategy, rand.New(rand.NewSource(3)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 200; i++ {
+			if got := b.Next(); got < 0 || got > time.Minute {
+				t.Fatalf("%s attempt %d: got %s, want within [0, 1m]", strategy, i, got)
+			}
+		}
+	}
+	if _, err := newRetryBackoff("bogus", nil); err == nil {
+		t.Error("unknown strategy accepted")
+	}
+}
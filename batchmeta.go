@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// batchLog writes one row per response to a sidecar CSV, recording the
+// server's Date header next to our clock to measure drift.
+type batchLog struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func openBatchLog(name string) (*batchLog, error) {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_RDWR, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	writer := csv.NewWriter(file)
+	writer.Comma = '\t'
+	if stat.Size() == 0 {
+		writer.Write([]string{"ScrapedAt", "ServerDate", "SkewSeconds", "Filter", "Count", "Since", "Max"})
+	}
+	return &batchLog{file: file, writer: writer}, nil
+}
+
+// record writes a batch row, the skew is empty if the Date header is missing or malformed
+func (b *batchLog) record(scrapedAt time.Time, serverDate string, filter string, data *Stream) error {
+	skew := ""
+	if t, err := http.ParseTime(serverDate); err == nil {
+		skew = strconv.FormatFloat(t.Sub(scrapedAt).Seconds(), 'f', 3, 64)
+	}
+	b.writer.Write([]string{
+		scrapedAt.Format(time.RFC3339Nano), serverDate, skew, filter,
+		strconv.Itoa(len(data.Messages)), strconv.FormatInt(data.Since, 10), strconv.FormatInt(data.Max, 10)})
+	b.writer.Flush()
+	return b.writer.Error()
+}
+
+func (b *batchLog) Close() error {
+	b.writer.Flush()
+	return b.file.Close()
+}
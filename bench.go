@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// benchBodies are the synthetic message bodies, with the emoji, cashtags,
+// line breaks and long texts that real messages hold
+var benchBodies = []string{
+	"$AAPL breaking out 🚀🚀🚀 next stop $200",
+	"Bought more $AAPL and $MSFT today.\nHolding through earnings 💎🙌",
+	"$TSLA\t$AAPL\t$NVDA all green, \"told you so\" 📈",
+	strings.Repeat("Long read on $AAPL margins, services growth and buybacks. ", 20),
+	"bearish 🐻 $AAPL gap fill incoming, stop at 180 #options",
+}
+
+// benchServer serves a symbol page and a synthetic stream of perPage*pages
+// messages in the shape of the StockTwits API
+type benchServer struct {
+	perPage int64
+	pages   int64
+	start   time.Time
+	served  atomic.Int64
+}
+
+func (b *benchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// anything but the stream API is the symbol page, whatever -symbol-in-url-prefix is
+	if !strings.HasPrefix(r.URL.Path, "/streams/") {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><meta name="csrf-token" content="bench"></head>`+
+			`<body><ol class="stream-list" stream-id="1"></ol></body></html>`)
+		return
+	}
+	total := b.perPage * b.pages
+	max := total + 1
+	if m := r.URL.Query().Get("max"); m != "" {
+		max, _ = strconv.ParseInt(m, 10, 64)
+	}
+	type user struct {
+		ID       int64  `json:"id"`
+		Username string `json:"username"`
+	}
+	type message struct {
+		ID        int64               `json:"id"`
+		Body      string              `json:"body"`
+		CreatedAt string              `json:"created_at"`
+		Sentiment map[string]string   `json:"sentiment,omitempty"`
+		Likes     int64               `json:"total_likes"`
+		Symbols   []map[string]string `json:"symbols"`
+		User      user                `json:"user"`
+	}
+	var msgs []message
+	for id := max - 1; id > 0 && id > max-1-b.perPage; id-- {
+		m := message{
+			ID:        id,
+			Body:      benchBodies[id%int64(len(benchBodies))],
+			CreatedAt: b.start.Add(-time.Duration(total-id) * time.Minute).Format("Mon, 02 Jan 2006 15:04:05 -0000"),
+			Likes:     id % 13,
+			Symbols:   []map[string]string{{"symbol": "AAPL"}, {"symbol": "MSFT"}},
+			User:      user{ID: id % 97, Username: fmt.Sprintf("trader%d", id%97)},
+		}
+		if id%3 == 0 {
+			m.Sentiment = map[string]string{"class": "bullish", "name": "Bullish"}
+		}
+		msgs = append(msgs, m)
+	}
+	b.served.Add(1)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"more": len(msgs) > 0, "messages": msgs})
+}
+
+// forFixture returns the configuration of a run without flags scraping
+// the whole stream of the in-process server at url into dir, as fast as it
+// serves. Only the settings of how rows are decoded and written come from
+// cfg: the requests, stop conditions and filters of the user's run would
+// change what is tested.
+func (cfg *config) forFixture(dir, url string) (*config, error) {
+	fixtureCfg, err := parseFlags(flag.NewFlagSet("fixture", flag.ContinueOnError), nil, noEnv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture configuration: %s", err)
+	}
+	fixtureCfg.outDir, fixtureCfg.baseURL, fixtureCfg.delay = dir, url, 0
+	fixtureCfg.logFile, fixtureCfg.seed, fixtureCfg.rand = cfg.logFile, cfg.seed, cfg.rand
+	fixtureCfg.quote, fixtureCfg.quoteIDs, fixtureCfg.outputTZ = cfg.quote, cfg.quoteIDs, cfg.outputTZ
+	fixtureCfg.streamDecode, fixtureCfg.timing = cfg.streamDecode, cfg.timing
+	return fixtureCfg, nil
+}
+
+// noEnv looks up no environment variable, the fixtures ignore them
+func noEnv(string) (string, bool) {
+	return "", false
+}
+
+// withPipeline copies the settings of the user's pipeline that the
+// synthetic messages pass, to measure them: the filters, their merging,
+// the order of rows and the sidecars written along
+func (cfg *config) withPipeline(user *config) {
+	cfg.filters, cfg.dedupMax, cfg.sortOrder = user.filters, user.dedupMax, user.sortOrder
+	cfg.symbolFilter, cfg.filterExpr, cfg.anonymizer = user.symbolFilter, user.filterExpr, user.anonymizer
+	cfg.translateCmd, cfg.translateSkip = user.translateCmd, user.translateSkip
+	cfg.batchMeta, cfg.flips, cfg.roster = user.batchMeta, user.flips, user.roster
+	cfg.checkpointInterval = user.checkpointInterval
+}
+
+// runBench scrapes a synthetic stream from an in-process server with the
+// configured pipeline and reports throughput and memory use
+func runBench(cfg *config) error {
+	perPage, pages := cfg.benchPerPage, cfg.benchPages
+	dir, err := os.MkdirTemp("", "stockscraper-bench")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	server := &benchServer{perPage: int64(perPage), pages: int64(pages), start: time.Now().UTC()}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	benchCfg, err := cfg.forFixture(dir, ts.URL)
+	if err != nil {
+		return err
+	}
+	benchCfg.withPipeline(cfg)
+
+	var peak atomic.Uint64
+	stop := make(chan struct{})
+	var sampler sync.WaitGroup
+	sampler.Add(1)
+	go func() {
+		defer sampler.Done()
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > peak.Load() {
+				peak.Store(m.HeapInuse)
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	started := time.Now()
+	err = scrape(benchCfg)
+	elapsed := time.Since(started)
+	runtime.ReadMemStats(&after)
+	close(stop)
+	sampler.Wait()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(benchCfg.outputPath(".csv"))
+	if err != nil {
+		return err
+	}
+	// less the #schema line and the header
+	rows := bytes.Count(data, []byte("\n")) - 2
+	served := server.served.Load()
+	logger.Printf("bench: %d pages of %d messages, %d rows in %s\n", served, perPage, rows, elapsed.Round(time.Millisecond))
+	logger.Printf("bench: %.1f pages/s, %.1f rows/s\n", float64(served)/elapsed.Seconds(), float64(rows)/elapsed.Seconds())
+	logger.Printf("bench: %.1f MiB allocated in %d allocations (%d per row), %d GCs, peak heap %.1f MiB\n",
+		float64(after.TotalAlloc-before.TotalAlloc)/(1<<20), after.Mallocs-before.Mallocs,
+		(after.Mallocs-before.Mallocs)/uint64(rows+1), after.NumGC-before.NumGC, float64(peak.Load())/(1<<20))
+	return nil
+}
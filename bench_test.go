@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// configWithArgs returns the configuration of a run with the flags args
+func configWithArgs(t testing.TB, args ...string) *config {
+	var cfg *config
+	withArgs(t, args, func() {
+		var err error
+		if cfg, err = parseConfig(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// sends the collector events to the logger rather than stdout
+	cfg.logFile = os.DevNull
+	return cfg
+}
+
+// defaultConfig returns the configuration of a run without flags
+func defaultConfig(t testing.TB) *config {
+	return configWithArgs(t)
+}
+
+func TestSelftest(t *testing.T) {
+	quietLogger(t)
+	if err := runSelftest(defaultConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+	// nothing of the user's run but how rows are written applies to the canned stream
+	for _, args := range []string{
+		"-filter-user-type professional -min-followers 1000",
+		"-min-messages-per-batch 10 -min-batch-consecutive 2",
+		"-tor socks5://127.0.0.1:9",
+		"-cache-dir " + t.TempDir(),
+		"-header Cookie:session=1",
+		"-exit-on-more-false -validate-response",
+		"-conversation 42",
+		"-filter-param suggested,all -sort-order asc -require-tagged TSLA",
+		"-date 2100-01-01 -id 5 -base-url http://127.0.0.1:9",
+		"-quote always -quote-ids -output-tz America/New_York -stream-decode",
+	} {
+		if err := runSelftest(configWithArgs(t, strings.Fields(args)...)); err != nil {
+			t.Errorf("with %s: %s", args, err)
+		}
+	}
+}
+
+func TestRunBenchCountsRows(t *testing.T) {
+	quietLogger(t)
+	var out bytes.Buffer
+	logger = log.New(&out, "", 0)
+	cfg := defaultConfig(t)
+	cfg.benchPerPage, cfg.benchPages, cfg.userType = 5, 3, "retail"
+	if err := runBench(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// the #schema line and the header are not rows
+	if !strings.Contains(out.String(), " 15 rows in ") {
+		t.Fatalf("want 15 rows reported, got:\n%s", out.String())
+	}
+}
+
+func TestFixtureOutputIsDeterministic(t *testing.T) {
+	quietLogger(t)
+	server := &benchServer{perPage: 7, pages: 5, start: time.Now().UTC()}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	// two filters, so rows are merged and tagged with SourceFilter
+	user := configWithArgs(t, "-filter-param", "suggested,all")
+	var outputs [2][]byte
+	for i := range outputs {
+		cfg, err := user.forFixture(t.TempDir(), ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.withPipeline(user)
+		if err := scrape(cfg); err != nil {
+			t.Fatal(err)
+		}
+		jsonl := cfg.outputPath(".jsonl")
+		if _, err := runConvert(cfg.outputPath(".csv"), jsonl); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{cfg.outputPath(".csv"), jsonl} {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputs[i] = append(outputs[i], data...)
+		}
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Fatalf("two scrapes of the same fixture differ:\n%s\n---\n%s", outputs[0], outputs[1])
+	}
+	if !bytes.Contains(outputs[0], []byte("\tall,suggested\n")) {
+		t.Fatalf("rows are not tagged with both filters:\n%s", outputs[0])
+	}
+}
+
+// BenchmarkEndToEnd scrapes the synthetic stream of -bench, 30 messages
+// a page, through the whole pipeline, from the requests to the output file
+func BenchmarkEndToEnd(b *testing.B) {
+	quietLogger(b)
+	cfg := defaultConfig(b)
+	const perPage, pages = 30, 20
+	server := &benchServer{perPage: perPage, pages: pages, start: time.Now().UTC()}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		dir, err := os.MkdirTemp("", "stockscraper-bench")
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchCfg, err := cfg.forFixture(dir, ts.URL)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		if err := scrape(benchCfg); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		os.RemoveAll(dir)
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(b.N*perPage*pages)/b.Elapsed().Seconds(), "rows/s")
+}
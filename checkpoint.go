@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// checkpoint is the SYMBOL.checkpoint.json sidecar, the progress of the
+// current run. It is replaced after every page and every
+// -checkpoint-interval, so that it is recent even while a page is slow or
+// the run is paused. The next run goes on from it if the run was
+// interrupted, see resume.
+type checkpoint struct {
+	Symbol    string    `json:"symbol"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Rows      int       `json:"rows"`
+	// Written is the max each filter goes on below when resumed: every
+	// message it reported at or above it is written, none is held by the
+	// filter merger, see filterMerger.resumeFrom
+	Written map[string]int64 `json:"written"`
+	// Stopped is why each filter stopped, for those whose last page is written
+	Stopped map[string]string `json:"stopped,omitempty"`
+	// SinceID is the existing row each filter stops at, 0 for none
+	SinceID map[string]int64 `json:"since_id,omitempty"`
+}
+
+// readCheckpoint reads the sidecar name, nil if there is none
+func readCheckpoint(name string) (*checkpoint, error) {
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp := &checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// resume sets streams to go on from the interrupted run of cp and reports
+// whether it was interrupted, that is some filter had not stopped. Those
+// page on below where their written messages end down to the same
+// existing row. The others
+// have nothing left to scrape but the messages since, above latest, the
+// newest row of the output file. Filters the run did not scrape are left
+// as they are.
+func (cp *checkpoint) resume(streams map[string]*streamState, latest int64) bool {
+	interrupted := false
+	for filter := range streams {
+		if _, ok := cp.Written[filter]; ok && cp.Stopped[filter] == "" {
+			interrupted = true
+		}
+	}
+	if !interrupted {
+		return false
+	}
+	for filter, stream := range streams {
+		if _, ok := cp.Written[filter]; !ok {
+			continue
+		}
+		if cp.Stopped[filter] == "" {
+			stream.prevMax, stream.sinceID = cp.Written[filter], cp.SinceID[filter]
+		} else if latest > stream.sinceID {
+			stream.sinceID = latest
+		}
+	}
+	return true
+}
+
+// writeCheckpoint replaces the sidecar name atomically
+func writeCheckpoint(name string, cp *checkpoint) error {
+	cp.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// checkpointTicker calls flush every interval until stop returns
+type checkpointTicker struct {
+	ticker *time.Ticker
+	quit   chan struct{}
+	exited chan struct{}
+}
+
+func startCheckpointTicker(interval time.Duration, flush func()) *checkpointTicker {
+	t := &checkpointTicker{ticker: time.NewTicker(interval), quit: make(chan struct{}), exited: make(chan struct{})}
+	go func() {
+		defer close(t.exited)
+		for {
+			select {
+			case <-t.ticker.C:
+				flush()
+			case <-t.quit:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// stop stops the ticker and waits for a flush in progress
+func (t *checkpointTicker) stop() {
+	t.ticker.Stop()
+	close(t.quit)
+	<-t.exited
+}
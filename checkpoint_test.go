@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "AAPL.checkpoint.json")
+	if cp, err := readCheckpoint(name); err != nil || cp != nil {
+		t.Fatalf("readCheckpoint without a file = %v, %v, want nothing", cp, err)
+	}
+	want := &checkpoint{Symbol: "AAPL", Rows: 40,
+		Written: map[string]int64{"all": 1001, "suggested": 990},
+		Stopped: map[string]string{"suggested": "reached -date"},
+		SinceID: map[string]int64{"all": 500}}
+	if err := writeCheckpoint(name, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readCheckpoint(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Symbol != "AAPL" || got.Written["all"] != 1001 || got.Stopped["suggested"] != "reached -date" || got.SinceID["all"] != 500 {
+		t.Fatalf("read back %+v", got)
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	newStreams := func() map[string]*streamState {
+		return map[string]*streamState{"all": {sinceID: 100}, "suggested": {sinceID: 100}}
+	}
+
+	// every filter stopped: nothing to resume
+	done := &checkpoint{Written: map[string]int64{"all": 300, "suggested": 310},
+		Stopped: map[string]string{"all": "reached -date", "suggested": "no more messages"}}
+	streams := newStreams()
+	if done.resume(streams, 900) {
+		t.Fatal("resumed a run whose filters all stopped")
+	}
+	if s := streams["all"]; s.prevMax != 0 || s.sinceID != 100 {
+		t.Fatalf("stream changed to %+v", s)
+	}
+
+	// all was interrupted at 600 on its way down to 100
+	interrupted := &checkpoint{Written: map[string]int64{"all": 600, "suggested": 310},
+		Stopped: map[string]string{"suggested": "caught up with existing rows"},
+		SinceID: map[string]int64{"all": 100, "suggested": 100}}
+	streams = newStreams()
+	if !interrupted.resume(streams, 900) {
+		t.Fatal("did not resume an interrupted run")
+	}
+	if s := streams["all"]; s.prevMax != 600 || s.sinceID != 100 {
+		t.Fatalf("interrupted stream resumed as %+v, want below 600 down to 100", s)
+	}
+	// suggested only fetches what is newer than the rows written since
+	if s := streams["suggested"]; s.prevMax != 0 || s.sinceID != 900 {
+		t.Fatalf("stopped stream resumed as %+v, want from the head down to 900", s)
+	}
+
+	// a filter the interrupted run did not scrape starts as usual
+	streams = newStreams()
+	streams["new"] = &streamState{sinceID: 100}
+	interrupted.resume(streams, 900)
+	if s := streams["new"]; s.prevMax != 0 || s.sinceID != 100 {
+		t.Fatalf("new stream resumed as %+v, want its own start", s)
+	}
+	streams = map[string]*streamState{"new": {sinceID: 100}}
+	if interrupted.resume(streams, 900) {
+		t.Fatal("resumed with none of the interrupted filters")
+	}
+}
+
+// splitStreamServer serves the even IDs of bench to the suggested filter
+// and the odd ones to all, so that each filter has messages of its own.
+// While failing, all fails its pages below 41 once suggested reached its
+// end, and the merger holds every message of suggested below 41.
+type splitStreamServer struct {
+	bench         *benchServer
+	failing       atomic.Bool
+	suggestedDone chan struct{}
+	once          sync.Once
+}
+
+func (s *splitStreamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+	if filter == "" {
+		s.bench.ServeHTTP(w, r)
+		return
+	}
+	if max, err := strconv.ParseInt(r.URL.Query().Get("max"), 10, 64); err == nil && max <= 41 &&
+		filter == "all" && s.failing.Load() {
+		<-s.suggestedDone
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	rec := httptest.NewRecorder()
+	s.bench.ServeHTTP(rec, r)
+	var page struct {
+		More     bool                     `json:"more"`
+		Messages []map[string]interface{} `json:"messages"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &page)
+	kept := page.Messages[:0]
+	for _, msg := range page.Messages {
+		if even := int64(msg["id"].(float64))%2 == 0; even == (filter == "suggested") {
+			kept = append(kept, msg)
+		}
+	}
+	page.Messages = kept
+	if filter == "suggested" && len(kept) == 0 {
+		s.once.Do(func() { close(s.suggestedDone) })
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func TestResumeWritesHeldMessages(t *testing.T) {
+	quietLogger(t)
+	server := &splitStreamServer{bench: &benchServer{perPage: 10, pages: 5, start: time.Now().UTC()},
+		suggestedDone: make(chan struct{})}
+	server.failing.Store(true)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	cfg, err := defaultConfig(t).forFixture(t.TempDir(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.filters, cfg.retry, cfg.checkpointInterval = []string{"suggested", "all"}, 0, time.Hour
+
+	// all fails at 41 while the merger holds the messages of suggested below it
+	if err := scrape(cfg); err == nil {
+		t.Fatal("the interrupted run succeeded")
+	}
+	if n := countRows(t, cfg.outputPath(".csv")); n != 10 {
+		t.Fatalf("the interrupted run wrote %d rows, want the 10 above 41", n)
+	}
+	cp, err := readCheckpoint(cfg.outputPath(".checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// suggested reached its end, but its messages below 41 were never written
+	for _, filter := range []string{"suggested", "all"} {
+		if cp.Written[filter] != 41 || cp.Stopped[filter] != "" {
+			t.Fatalf("checkpoint of %s: written %d, stopped %q, want to go on below 41", filter, cp.Written[filter], cp.Stopped[filter])
+		}
+	}
+
+	server.failing.Store(false)
+	if err := scrape(cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(cfg.outputPath(".csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n")[2:] {
+		seen[strings.SplitN(line, "\t", 2)[0]]++
+	}
+	for id := 1; id <= 50; id++ {
+		if n := seen[strconv.Itoa(id)]; n != 1 {
+			t.Errorf("message %d written %d times after the resume, want once", id, n)
+		}
+	}
+}
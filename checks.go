@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// startupCheckTimeout bounds each check of -validate-only and
+// startupChecksTimeout all of them, so that it ends within 30s
+const (
+	startupCheckTimeout  = 10 * time.Second
+	startupChecksTimeout = 30 * time.Second
+)
+
+// startupCheck is one step of -validate-only
+type startupCheck struct {
+	name  string
+	check func() error
+}
+
+// runStartupChecks runs every check with a timeout of each, cut short so
+// that all of them end within total, and reports whether all passed
+func runStartupChecks(checks []startupCheck, each, total time.Duration) bool {
+	deadline := time.Now().Add(total)
+	ok := true
+	for _, c := range checks {
+		timeout := each
+		if left := time.Until(deadline); left < timeout {
+			timeout = left
+		}
+		var err error
+		if timeout <= 0 {
+			err = fmt.Errorf("not run, the checks took %s", total)
+		} else {
+			result := make(chan error, 1)
+			go func(check func() error) { result <- check() }(c.check)
+			select {
+			case err = <-result:
+			case <-time.After(timeout):
+				err = fmt.Errorf("timed out after %s", timeout)
+			}
+		}
+		if err != nil {
+			ok = false
+			logger.Printf("FAIL %s: %s\n", c.name, err)
+		} else {
+			logger.Printf("ok   %s\n", c.name)
+		}
+	}
+	return ok
+}
+
+// startupChecks lists the checks that need more than flag parsing
+func startupChecks(cfg *config) []startupCheck {
+	fName := cfg.outputPath(".csv")
+	checks := []startupCheck{
+		{"output directory is writable", func() error {
+			f, err := os.CreateTemp(filepath.Dir(fName), ".stockscraper-check-")
+			if err != nil {
+				return err
+			}
+			f.Close()
+			return os.Remove(f.Name())
+		}},
+		{"journal is readable", func() error {
+			jName := cfg.outputPath(".journal")
+			f, err := openFiles.openFile(jName, os.O_RDONLY, 0)
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			j := &journal{f: f}
+			defer j.Close()
+			_, err = j.pending()
+			return err
+		}},
+	}
+	if cfg.tor != "" {
+		checks = append(checks, startupCheck{"proxy is reachable", func() error {
+			return dialProxy(cfg.tor, startupCheckTimeout)
+		}})
+	}
+	if cfg.ackFile != "" {
+		checks = append(checks, startupCheck{"terms of service are acknowledged", func() error {
+			return checkAcknowledgement(cfg.ackFile)
+		}})
+	}
+	return checks
+}
+
+// dialProxy connects to the proxy of the URL proxy, such as the -tor
+// socks5://127.0.0.1:9050, and closes the connection at once
+func dialProxy(proxy string, timeout time.Duration) error {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port, ok := map[string]string{"socks5": "1080", "socks5h": "1080", "http": "80", "https": "443"}[u.Scheme]
+		if !ok {
+			return fmt.Errorf("%s has no port", proxy)
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
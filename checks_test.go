@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialProxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	if err := dialProxy("socks5://"+addr, time.Second); err != nil {
+		t.Fatalf("dialProxy to a listening proxy: %s", err)
+	}
+	ln.Close()
+	if err := dialProxy("socks5://"+addr, time.Second); err == nil {
+		t.Fatal("dialProxy to a closed port succeeded")
+	}
+	if err := dialProxy("tor://127.0.0.1", time.Second); err == nil {
+		t.Fatal("dialProxy without a port for the scheme succeeded")
+	}
+}
+
+func TestRunStartupChecksTotalTimeout(t *testing.T) {
+	quietLogger(t)
+	released := make(chan struct{})
+	defer close(released)
+	hang := func() error { <-released; return nil }
+	checks := []startupCheck{
+		{"passes", func() error { return nil }},
+		{"hangs", hang},
+		{"hangs too", hang},
+		{"never run", func() error { return errors.New("unreachable") }},
+	}
+	start := time.Now()
+	if runStartupChecks(checks, 40*time.Millisecond, 60*time.Millisecond) {
+		t.Fatal("checks that hang passed")
+	}
+	// each hanging check gets at most what is left of the total
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Fatalf("checks took %s, want them bounded by 60ms", took)
+	}
+}
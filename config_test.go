@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// withArgs runs f with the command line args on fresh flags that report
+// errors instead of exiting, and stdout discarded
+func withArgs(t testing.TB, args []string, f func()) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	savedArgs, savedFlags, savedLogger, savedStdout := os.Args, flag.CommandLine, logger, os.Stdout
+	defer func() { os.Args, flag.CommandLine, logger, os.Stdout = savedArgs, savedFlags, savedLogger, savedStdout }()
+	os.Stdout = devNull
+	os.Args = append([]string{"stockscraper"}, args...)
+	flag.CommandLine = flag.NewFlagSet("stockscraper", flag.ContinueOnError)
+	flag.CommandLine.SetOutput(io.Discard)
+	f()
+}
+
+func TestParseConfigRejectsBadFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+	}{
+		{"delay not a duration", "-delay soon"},
+		{"negative delay", "-delay -1s"},
+		{"retry below -1", "-retry -2"},
+		{"retry not a number", "-retry many"},
+		{"date not a date", "-date yesterday"},
+		{"date out of range", "-date 2014-13-01"},
+		{"date-consecutive zero", "-date-consecutive 0"},
+		{"convert without convert-out", "-convert AAPL.csv"},
+		{"convert-out without convert", "-convert-out AAPL.jsonl"},
+		{"convert onto itself", "-convert AAPL.csv -convert-out AAPL.csv"},
+		{"unknown output time zone", "-output-tz Mars/Olympus"},
+		{"unknown quoting", "-quote sometimes"},
+		{"file mode not octal", "-file-mode 0999"},
+		{"unknown flag", "-no-such-flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withArgs(t, strings.Fields(tt.args), func() {
+				// parseConfig fails before run does anything else
+				if code := run(); code != exitUsage {
+					t.Errorf("run %s = %d, want exitUsage %d", tt.args, code, exitUsage)
+				}
+			})
+		})
+	}
+}
+
+func TestParseConfigAcceptsValidFlags(t *testing.T) {
+	tests := []string{
+		"",
+		"-delay 2s -retry -1 -date 2020-02-29",
+		"-convert AAPL.csv -convert-out AAPL.jsonl",
+		"-output-tz America/New_York -quote always -file-mode 600",
+	}
+	for _, args := range tests {
+		withArgs(t, strings.Fields(args), func() {
+			if _, err := parseConfig(); err != nil {
+				t.Errorf("parseConfig %q: %s", args, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// escapedColumns are the columns whose newlines the scraper writes as \n
+var escapedColumns = map[string]bool{"Body": true, "TranslatedBody": true}
+
+// outputReader reads an output file in either format: the tab separated
+// one the scraper writes, newlines in bodies escaped as \n and tabs
+// replaced by spaces, or RFC 4180 CSV as written by -convert. The format
+// is told by the separator of the header line. Escaped newlines are
+// restored, so a body that held the two characters \ and n reads with a
+// newline instead: the escaping cannot tell them apart. Tabs replaced by
+// spaces cannot be restored either.
+type outputReader struct {
+	reader *csv.Reader
+	// Header is the first line of the file
+	Header []string
+	// Escaped tells the scraper's own format
+	Escaped bool
+}
+
+func newOutputReader(r io.Reader) (*outputReader, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(4096)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	// the header is the first line that is not a comment such as #schema
+	for bytes.HasPrefix(first, []byte("#")) {
+		i := bytes.IndexByte(first, '\n')
+		if i < 0 {
+			return nil, errors.New("no header")
+		}
+		first = first[i+1:]
+	}
+	if i := bytes.IndexByte(first, '\n'); i >= 0 {
+		first = first[:i]
+	}
+	o := &outputReader{reader: csv.NewReader(br)}
+	o.reader.Comment = '#'
+	o.Escaped = bytes.IndexByte(first, '\t') >= 0
+	if o.Escaped {
+		o.reader.Comma = '\t'
+		// files written by hand or by older versions may leave quotes bare
+		o.reader.LazyQuotes = true
+	} else if bytes.IndexByte(first, ',') < 0 {
+		return nil, fmt.Errorf("header %q is neither tab nor comma separated", first)
+	}
+	if o.Header, err = o.reader.Read(); err != nil {
+		return nil, fmt.Errorf("cannot read the header: %s", err)
+	}
+	if len(o.Header) == 0 || o.Header[0] != "Id" {
+		return nil, fmt.Errorf("header %q does not start with Id, not an output file", o.Header)
+	}
+	o.reader.FieldsPerRecord = len(o.Header)
+	return o, nil
+}
+
+// Read returns the next row, its bodies unescaped
+func (o *outputReader) Read() ([]string, error) {
+	row, err := o.reader.Read()
+	if err != nil || !o.Escaped {
+		return row, err
+	}
+	for i, name := range o.Header {
+		if escapedColumns[name] {
+			row[i] = strings.Replace(row[i], "\\n", "\n", -1)
+		}
+	}
+	return row, nil
+}
+
+// runConvert rewrites the output file in as out: JSONL, one object per row
+// keyed by column, if out ends in .jsonl, else RFC 4180 CSV with the
+// newlines of the bodies kept in quoted fields
+func runConvert(in, out string) (int, error) {
+	src, err := os.Open(in)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	reader, err := newOutputReader(src)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", in, err)
+	}
+	tmp := out + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	defer dst.Close()
+	w := bufio.NewWriter(dst)
+	var writeRow func([]string) error
+	if strings.HasSuffix(out, ".jsonl") {
+		writeRow = func(row []string) error {
+			return writeJSONRow(w, reader.Header, row)
+		}
+	} else {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(reader.Header); err != nil {
+			return 0, err
+		}
+		writeRow = func(row []string) error {
+			writer.Write(row)
+			writer.Flush()
+			return writer.Error()
+		}
+	}
+	rows := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, fmt.Errorf("%s: %s", in, err)
+		}
+		if err := writeRow(row); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+	if err := w.Flush(); err != nil {
+		return rows, err
+	}
+	if err := dst.Close(); err != nil {
+		return rows, err
+	}
+	return rows, os.Rename(tmp, out)
+}
+
+// writeJSONRow writes row as a JSON object in the order of header, Likes
+// and the boolean columns as JSON numbers and booleans. Id stays a string
+// as with -quote-ids, a JSON number above 2^53 loses precision in
+// JavaScript.
+func writeJSONRow(w *bufio.Writer, header, row []string) error {
+	w.WriteByte('{')
+	for i, name := range header {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		w.Write(key)
+		w.WriteByte(':')
+		value := row[i]
+		switch name {
+		case "Likes":
+			if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+				w.WriteString(value)
+				continue
+			}
+		case "SuspectTS", "LikedByCurrentUser", "ResharedByCurrentUser":
+			if b, err := strconv.ParseBool(value); err == nil {
+				w.WriteString(strconv.FormatBool(b))
+				continue
+			}
+		}
+		quoted, _ := json.Marshal(value)
+		w.Write(quoted)
+	}
+	_, err := w.WriteString("}\n")
+	return err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// legacyOutput is an output file as the scraper writes it, the body of
+// 1019 having held the two characters \ and n, that of 1018 a tab
+const legacyOutput = "#schema:v3\n" +
+	"Id\tCreatedAt\tBody\tSentiment\tLikes\tUserType\tSuspectTS\n" +
+	"9007199254740993\t2024-05-01T10:00:00Z\tline one\\nline two\tBullish\t3\tretail\tfalse\n" +
+	"1019\t2024-05-01T09:00:00Z\tC:\\new folder, \"quoted\"\t\t0\t\ttrue\n" +
+	"1018\t2024-05-01T08:00:00Z\ta  tab\t\t0\tprofessional\tfalse\n"
+
+func convert(t *testing.T, in, out string) string {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "AAPL.csv")
+	if err := os.WriteFile(src, []byte(in), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, out)
+	rows, err := runConvert(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 3 {
+		t.Fatalf("converted %d rows, want 3", rows)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestConvertToJSONL(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(convert(t, legacyOutput, "AAPL.jsonl"), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	// the ID above 2^53 must not be a number that rounds
+	if want := `{"Id":"9007199254740993","CreatedAt":"2024-05-01T10:00:00Z","Body":"line one\nline two",` +
+		`"Sentiment":"Bullish","Likes":3,"UserType":"retail","SuspectTS":false}`; lines[0] != want {
+		t.Fatalf("first line\n%s\nwant\n%s", lines[0], want)
+	}
+	var row map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &row); err != nil {
+		t.Fatal(err)
+	}
+	// the escaping cannot tell a \n the body held from a newline
+	if row["Id"] != "1019" || row["Body"] != "C:\new folder, \"quoted\"" || row["SuspectTS"] != true {
+		t.Fatalf("second row is %v", row)
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	csv := convert(t, legacyOutput, "AAPL.rfc.csv")
+	if !strings.HasPrefix(csv, "Id,CreatedAt,Body,") {
+		t.Fatalf("converted CSV starts with %q", strings.SplitN(csv, "\n", 2)[0])
+	}
+	if !strings.Contains(csv, "\"line one\nline two\"") {
+		t.Fatalf("the newline is not kept in a quoted field:\n%s", csv)
+	}
+	// a converted file converts again to the same JSONL
+	if again, once := convert(t, csv, "AAPL.jsonl"), convert(t, legacyOutput, "AAPL.jsonl"); again != once {
+		t.Fatalf("converting the CSV gives\n%s\nconverting the output gives\n%s", again, once)
+	}
+}
+
+func TestOutputReaderRefusesOtherFiles(t *testing.T) {
+	for _, in := range []string{"", "#schema:v3\n", "hello world\n", "Name\tValue\nx\t1\n"} {
+		if _, err := newOutputReader(strings.NewReader(in)); err == nil {
+			t.Errorf("newOutputReader(%q) accepted a file that is not an output file", in)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// rowWriter writes delimited records, it is implemented by csv.Writer and quotingWriter
+type rowWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// newRowWriter returns a writer for the given -quote mode, "always" or
+// "minimal", quoting the first column, the ID, in any case if quoteIDs is set
+func newRowWriter(w io.Writer, quote string, quoteIDs bool) rowWriter {
+	if quote == "always" {
+		return &quotingWriter{Comma: '\t', w: bufio.NewWriter(w), all: true}
+	}
+	if quoteIDs {
+		return &quotingWriter{Comma: '\t', w: bufio.NewWriter(w)}
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = '\t'
+	return writer
+}
+
+// quotingWriter is like csv.Writer but quotes every field if all is set,
+// for strict consumers that do not accept minimal quoting. Otherwise it
+// quotes the first field and the others only where csv.Writer would, so
+// that the IDs read as strings rather than numbers that lose precision.
+type quotingWriter struct {
+	Comma rune
+	w     *bufio.Writer
+	all   bool
+	err   error
+}
+
+// Write writes a single record, doubling any quote inside a field.
+func (qw *quotingWriter) Write(record []string) error {
+	if qw.err != nil {
+		return qw.err
+	}
+	for i, field := range record {
+		if i > 0 {
+			qw.w.WriteRune(qw.Comma)
+		}
+		if !qw.all && i > 0 && !qw.needsQuotes(field) {
+			qw.w.WriteString(field)
+			continue
+		}
+		qw.w.WriteByte('"')
+		qw.w.WriteString(strings.Replace(field, `"`, `""`, -1))
+		qw.w.WriteByte('"')
+	}
+	_, qw.err = qw.w.WriteString("\n")
+	return qw.err
+}
+
+// needsQuotes reports whether csv.Writer would quote field
+func (qw *quotingWriter) needsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.ContainsAny(field, "\"\r\n"+string(qw.Comma)) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r)
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (qw *quotingWriter) Flush() {
+	if err := qw.w.Flush(); err != nil && qw.err == nil {
+		qw.err = err
+	}
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (qw *quotingWriter) Error() error {
+	if qw.err != nil {
+		return qw.err
+	}
+	_, err := qw.w.Write(nil)
+	return err
+}
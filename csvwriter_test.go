@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// awkwardRecords hold the fields a body may bring: quotes, tabs, newlines,
+// a byte order mark and leading spaces
+var awkwardRecords = [][]string{
+	{"Id", "Body", "Likes"},
+	{"1020", `he said "buy" and ""sold""`, "3"},
+	{"1019", "tab\tinside\tthe body", ""},
+	{"1018", "first line\nsecond line\n", "0"},
+	{"\ufeff1017", "\ufeffstarts with a BOM", " 7"},
+	{"1016", `"`, `\.`},
+	{"", "  leading spaces", "\t"},
+}
+
+func TestRowWriterRoundTrip(t *testing.T) {
+	modes := []struct {
+		name     string
+		quote    string
+		quoteIDs bool
+	}{
+		{"minimal", "minimal", false},
+		{"always", "always", false},
+		{"quote-ids", "minimal", true},
+	}
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newRowWriter(&buf, mode.quote, mode.quoteIDs)
+			for _, record := range awkwardRecords {
+				if err := w.Write(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w.Flush()
+			if err := w.Error(); err != nil {
+				t.Fatal(err)
+			}
+			reader := csv.NewReader(&buf)
+			reader.Comma = '\t'
+			got, err := reader.ReadAll()
+			if err != nil {
+				t.Fatalf("cannot read back:\n%s\n%s", buf.String(), err)
+			}
+			if !reflect.DeepEqual(got, awkwardRecords) {
+				t.Fatalf("read back %q, want %q", got, awkwardRecords)
+			}
+		})
+	}
+}
+
+func TestQuotingWriterQuotes(t *testing.T) {
+	tests := []struct {
+		quote    string
+		quoteIDs bool
+		want     string
+	}{
+		{"always", false, "\"1020\"\t\"a \"\"b\"\"\"\t\"3\"\n"},
+		{"minimal", true, "\"1020\"\t\"a \"\"b\"\"\"\t3\n"},
+		{"minimal", false, "1020\t\"a \"\"b\"\"\"\t3\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := newRowWriter(&buf, tt.quote, tt.quoteIDs)
+		w.Write([]string{"1020", `a "b"`, "3"})
+		w.Flush()
+		if got := buf.String(); got != tt.want {
+			t.Errorf("-quote %s -quote-ids=%t wrote %q, want %q", tt.quote, tt.quoteIDs, got, tt.want)
+		}
+	}
+}
+
+// TestQuotingWriterMatchesCSV checks that -quote-ids quotes the other
+// columns exactly where csv.Writer does
+func TestQuotingWriterMatchesCSV(t *testing.T) {
+	for _, field := range []string{"", "plain", " lead", "\tlead", "\vlead", "\u00a0nbsp", "\u3000ideographic",
+		"trail ", `\.`, "a\tb", "a\nb", `a"b`, "\u00e9t\u00e9"} {
+		var want, got bytes.Buffer
+		csvw := newRowWriter(&want, "minimal", false)
+		qw := newRowWriter(&got, "minimal", true)
+		for _, w := range []rowWriter{csvw, qw} {
+			w.Write([]string{"1", field})
+			w.Flush()
+		}
+		if wantRow := `"1"` + strings.TrimPrefix(want.String(), "1"); got.String() != wantRow {
+			t.Errorf("field %q: wrote %q, want %q", field, got.String(), wantRow)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// diagHeaders are the response headers recorded besides the rate limit ones
+var diagHeaders = []string{"Server", "Cf-Ray", "X-Request-Id", "Retry-After", "Content-Type"}
+
+// diagRecord is a line of the -diag file
+type diagRecord struct {
+	Time           time.Time         `json:"time"`
+	URL            string            `json:"url"`
+	Status         int               `json:"status"`
+	Error          string            `json:"error,omitempty"`
+	LatencyMS      int64             `json:"latency_ms"`
+	Retry          int               `json:"retry"`
+	RequestHeaders map[string]string `json:"request_headers"`
+	Headers        map[string]string `json:"headers"`
+}
+
+// diagLog appends a sample of the requests with the response headers
+// that tell about blocks and rate limits, one JSON object per line.
+type diagLog struct {
+	mutex  sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	sample float64
+	rand   *rand.Rand
+}
+
+func openDiagLog(name string, sample float64, rnd *rand.Rand) (*diagLog, error) {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(file)
+	enc.SetEscapeHTML(false)
+	return &diagLog{file: file, enc: enc, sample: sample, rand: rnd}, nil
+}
+
+// attach records the responses and errors of c. The send time and the retry
+// count are kept in the request context, which retries share.
+func (d *diagLog) attach(c *colly.Collector) {
+	c.OnRequest(func(r *colly.Request) {
+		r.Ctx.Put("diagSent", time.Now())
+	})
+	c.OnResponse(func(r *colly.Response) { d.record(r, nil) })
+	c.OnError(func(r *colly.Response, err error) {
+		d.record(r, err)
+		retry, _ := r.Ctx.GetAny("diagRetry").(int)
+		r.Ctx.Put("diagRetry", retry+1)
+	})
+}
+
+// record writes r if it is sampled
+func (d *diagLog) record(r *colly.Response, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.sample < 1 && d.rand.Float64() >= d.sample {
+		return
+	}
+	rec := diagRecord{
+		Time:           time.Now(),
+		URL:            r.Request.URL.String(),
+		Status:         r.StatusCode,
+		RequestHeaders: redactHeaders(*r.Request.Headers),
+		Headers:        map[string]string{},
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if sent, ok := r.Ctx.GetAny("diagSent").(time.Time); ok {
+		rec.LatencyMS = rec.Time.Sub(sent).Milliseconds()
+	}
+	rec.Retry, _ = r.Ctx.GetAny("diagRetry").(int)
+	if r.Headers != nil {
+		for name := range *r.Headers {
+			lower := strings.ToLower(name)
+			if containsString(diagHeaders, name) || strings.Contains(lower, "ratelimit") || strings.Contains(lower, "rate-limit") {
+				rec.Headers[name] = r.Headers.Get(name)
+			}
+		}
+	}
+	d.enc.Encode(rec)
+}
+
+// redactHeaders flattens hdr, replacing cookies, the CSRF token and other secrets
+func redactHeaders(hdr http.Header) map[string]string {
+	flat := map[string]string{}
+	for name := range hdr {
+		value := hdr.Get(name)
+		if secretFlag.MatchString(name) {
+			value = "REDACTED"
+		}
+		flat[name] = value
+	}
+	return flat
+}
+
+func (d *diagLog) Close() error {
+	return d.file.Close()
+}
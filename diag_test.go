@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gocolly/colly"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	hdr := http.Header{}
+	hdr.Set("Authorization", "Bearer abc")
+	hdr.Set("Cookie", "session=abc")
+	hdr.Set("X-Csrf-Token", "abc")
+	hdr.Set("X-Api-Key", "abc")
+	hdr.Set("Accept", "application/json")
+	hdr.Set("User-Agent", "Mozilla/5.0")
+	hdr.Set("X-Request-Id", "0b6f")
+	got := redactHeaders(hdr)
+	for _, name := range []string{"Authorization", "Cookie", "X-Csrf-Token", "X-Api-Key"} {
+		if got[name] != "REDACTED" {
+			t.Errorf("%s = %q, want it redacted", name, got[name])
+		}
+	}
+	for _, name := range []string{"Accept", "User-Agent", "X-Request-Id"} {
+		if got[name] != hdr.Get(name) {
+			t.Errorf("%s = %q, want %q passed through", name, got[name], hdr.Get(name))
+		}
+	}
+}
+
+// diagResponse returns a response to a request with a session cookie
+func diagResponse() *colly.Response {
+	u, _ := url.Parse("https://stocktwits.com/streams/poll?max=1")
+	reqHdr := http.Header{}
+	reqHdr.Set("Cookie", "session=abc")
+	respHdr := http.Header{}
+	respHdr.Set("Cf-Ray", "8a1b")
+	respHdr.Set("X-Ratelimit-Remaining", "0")
+	respHdr.Set("Set-Cookie", "session=def")
+	ctx := colly.NewContext()
+	return &colly.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Headers:    &respHdr,
+		Ctx:        ctx,
+		Request:    &colly.Request{URL: u, Headers: &reqHdr, Ctx: ctx},
+	}
+}
+
+// diagRecords records n responses sampled at sample and returns the lines written
+func diagRecords(t *testing.T, n int, sample float64) []diagRecord {
+	name := filepath.Join(t.TempDir(), "diag.jsonl")
+	d, err := openDiagLog(name, sample, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		d.record(diagResponse(), nil)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []diagRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec diagRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %s", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestDiagRecord(t *testing.T) {
+	records := diagRecords(t, 1, 1)
+	if len(records) != 1 {
+		t.Fatalf("%d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.Status != http.StatusTooManyRequests || rec.RequestHeaders["Cookie"] != "REDACTED" {
+		t.Fatalf("record %+v, want status 429 and the cookie redacted", rec)
+	}
+	// only the block and rate limit headers of the response are kept
+	if rec.Headers["Cf-Ray"] != "8a1b" || rec.Headers["X-Ratelimit-Remaining"] != "0" || rec.Headers["Set-Cookie"] != "" {
+		t.Fatalf("response headers %v", rec.Headers)
+	}
+}
+
+func TestDiagSampling(t *testing.T) {
+	if n := len(diagRecords(t, 100, 1)); n != 100 {
+		t.Fatalf("-diag-sample 1 recorded %d of 100 requests", n)
+	}
+	// 1 in 10 of 2000 requests, with room for chance
+	if n := len(diagRecords(t, 2000, 0.1)); n < 150 || n > 250 {
+		t.Fatalf("-diag-sample 0.1 recorded %d of 2000 requests, want about 200", n)
+	}
+}
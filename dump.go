@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gocolly/colly"
+)
+
+// dumpQueue is how many response bodies wait for the dump writer before
+// the collector blocks
+const dumpQueue = 64
+
+// dumpFile is a response body waiting to be written
+type dumpFile struct {
+	name string
+	body []byte
+}
+
+// responseDump writes the raw body of every response of a symbol to dir for
+// offline analysis: the symbol page to SYMBOL-page.html and the stream
+// responses to SYMBOL-response-N.json. Files are written by a goroutine so
+// the scrape does not wait for the disk.
+type responseDump struct {
+	dir    string
+	symbol string
+	queue  chan dumpFile
+	done   chan struct{}
+	// mutex guards n, the number of stream responses dumped so far
+	mutex sync.Mutex
+	n     int
+}
+
+func newResponseDump(dir, symbol string) (*responseDump, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	d := &responseDump{dir: dir, symbol: symbol, queue: make(chan dumpFile, dumpQueue), done: make(chan struct{})}
+	go d.write()
+	return d, nil
+}
+
+// attach dumps the responses of c, failed ones included
+func (d *responseDump) attach(c *colly.Collector) {
+	c.OnResponse(d.add)
+	c.OnError(func(r *colly.Response, err error) { d.add(r) })
+}
+
+func (d *responseDump) add(r *colly.Response) {
+	if len(r.Body) == 0 {
+		return
+	}
+	name := d.symbol + "-page.html"
+	if r.Ctx.Get("filter") != "" {
+		d.mutex.Lock()
+		d.n++
+		name = fmt.Sprintf("%s-response-%d.json", d.symbol, d.n)
+		d.mutex.Unlock()
+	}
+	d.queue <- dumpFile{name: filepath.Join(d.dir, name), body: r.Body}
+}
+
+func (d *responseDump) write() {
+	defer close(d.done)
+	warned := false
+	for f := range d.queue {
+		if err := os.WriteFile(f.name, f.body, fileMode); err != nil && !warned {
+			logger.Printf("WARNING: cannot dump response: %s, further failures are not logged\n", err)
+			warned = true
+		}
+	}
+}
+
+// Close waits for the queued responses to be written
+func (d *responseDump) Close() error {
+	close(d.queue)
+	<-d.done
+	return nil
+}
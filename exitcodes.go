@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes of the scraper, documented in the README
+const (
+	// exitComplete means every stream reached its end: -date, the newest
+	// existing row or the end of the stream
+	exitComplete = 0
+	// exitError is any hard error, e.g. a file that cannot be written
+	exitError = 1
+	// exitUsage means invalid flags, as the flag package itself exits with 2,
+	// or an output file of another schema version without -upgrade-schema
+	exitUsage = 2
+	// exitPartial means the run stopped early, e.g. after
+	// -min-messages-per-batch or a pagination loop, or some -resume-all
+	// symbols failed
+	exitPartial = 3
+	// exitSymbolNotFound means the symbol page could not be used
+	exitSymbolNotFound = 4
+	// exitRateLimited means retries were exhausted on 429 responses
+	exitRateLimited = 5
+	// exitInvalidOutput means -validate found malformed rows in the output
+	exitInvalidOutput = 6
+)
+
+// codedError is an error carrying the exit code it should end the process with
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// withCode wraps err to exit with code
+func withCode(code int, format string, a ...interface{}) error {
+	return &codedError{code: code, err: fmt.Errorf(format, a...)}
+}
+
+// exitCode returns the exit code for the result of a run
+func exitCode(err error) int {
+	if err == nil {
+		return exitComplete
+	}
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return exitError
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// messageEnv is the environment a -filter expression is evaluated against
+func messageEnv(msg *Message) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             msg.ID,
+		"body":           msg.Body,
+		"likes":          msg.TotalLikes,
+		"sentiment":      msg.sentiment(),
+		"username":       msg.User.Username,
+		"user_type":      msg.User.UserType,
+		"tagged_symbols": msg.taggedSymbols(),
+	}
+}
+
+// messageExpr is a compiled -filter expression
+type messageExpr struct {
+	source  string
+	program *vm.Program
+}
+
+// compileMessageExpr compiles source once, checking it yields a bool for any message
+func compileMessageExpr(source string) (*messageExpr, error) {
+	program, err := expr.Compile(source, expr.Env(messageEnv(&Message{})), expr.AsBool())
+	if err != nil {
+		return nil, err
+	}
+	return &messageExpr{source: source, program: program}, nil
+}
+
+// match reports whether msg satisfies the expression
+func (e *messageExpr) match(msg *Message) (bool, error) {
+	out, err := expr.Run(e.program, messageEnv(msg))
+	if err != nil {
+		return false, fmt.Errorf("-filter %q on message %d: %s", e.source, msg.ID, err)
+	}
+	return out.(bool), nil
+}
+
+func (e *messageExpr) String() string {
+	return e.source
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"container/list"
+	"os"
+	"sync"
+)
+
+// filePool caps the files held open by every symbol of the run, see
+// -max-open-files. Beyond max it closes the least recently used file not
+// in use, which is reopened for appending when next used. Writes go
+// straight to the file, so nothing is lost by closing it.
+type filePool struct {
+	mutex sync.Mutex
+	max   int
+	// lru holds the open files, the most recently used first
+	lru *list.List
+	// open opens a file, replaceable by a fake
+	open func(name string, flag int, perm os.FileMode) (*os.File, error)
+}
+
+// newFilePool returns a pool of at most max open files, 0 for no limit
+func newFilePool(max int) *filePool {
+	return &filePool{max: max, lru: list.New(), open: os.OpenFile}
+}
+
+// pooledFile is a file of a filePool, closed and reopened as needed
+type pooledFile struct {
+	pool *filePool
+	name string
+	flag int
+	file *os.File
+	elem *list.Element
+	// busy counts the calls using file, which may not close it
+	busy int
+	// reopens counts the times the file was opened again after a close
+	reopens int
+}
+
+// openFile opens name like os.OpenFile, reopening it with flag less
+// O_CREATE, O_EXCL and O_TRUNC
+func (p *filePool) openFile(name string, flag int, perm os.FileMode) (*pooledFile, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	f := &pooledFile{pool: p, name: name, flag: flag}
+	p.evict(p.max - 1)
+	file, err := p.open(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	f.file = file
+	f.flag &^= os.O_CREATE | os.O_EXCL | os.O_TRUNC
+	f.elem = p.lru.PushFront(f)
+	return f, nil
+}
+
+// evict closes the least recently used files not busy until at most n
+// are open; busy files may keep more open for the time of a call
+func (p *filePool) evict(n int) {
+	if p.max == 0 {
+		return
+	}
+	for e := p.lru.Back(); e != nil && p.lru.Len() > n; {
+		f := e.Value.(*pooledFile)
+		e = e.Prev()
+		if f.busy > 0 {
+			continue
+		}
+		f.file.Close()
+		f.file = nil
+		p.lru.Remove(f.elem)
+		f.elem = nil
+	}
+}
+
+// openFiles returns the number of files of the pool that are open
+func (p *filePool) openFiles() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.lru.Len()
+}
+
+// acquire returns the open file, reopening it if closed, until release
+func (f *pooledFile) acquire() (*os.File, error) {
+	p := f.pool
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if f.file == nil {
+		p.evict(p.max - 1)
+		file, err := p.open(f.name, f.flag, fileMode)
+		if err != nil {
+			return nil, err
+		}
+		f.file = file
+		f.elem = p.lru.PushFront(f)
+		f.reopens++
+	} else {
+		p.lru.MoveToFront(f.elem)
+	}
+	f.busy++
+	return f.file, nil
+}
+
+// reopened returns the number of times the file was reopened
+func (f *pooledFile) reopened() int {
+	f.pool.mutex.Lock()
+	defer f.pool.mutex.Unlock()
+	return f.reopens
+}
+
+func (f *pooledFile) release() {
+	f.pool.mutex.Lock()
+	defer f.pool.mutex.Unlock()
+	f.busy--
+	f.pool.evict(f.pool.max)
+}
+
+// Write implements io.Writer
+func (f *pooledFile) Write(b []byte) (int, error) {
+	file, err := f.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer f.release()
+	return file.Write(b)
+}
+
+func (f *pooledFile) Sync() error {
+	file, err := f.acquire()
+	if err != nil {
+		return err
+	}
+	defer f.release()
+	return file.Sync()
+}
+
+func (f *pooledFile) Truncate(size int64) error {
+	file, err := f.acquire()
+	if err != nil {
+		return err
+	}
+	defer f.release()
+	return file.Truncate(size)
+}
+
+// Stat returns the FileInfo of the file, open or not
+func (f *pooledFile) Stat() (os.FileInfo, error) {
+	return os.Stat(f.name)
+}
+
+// Close closes the file and leaves the pool
+func (f *pooledFile) Close() error {
+	p := f.pool
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	p.lru.Remove(f.elem)
+	f.elem = nil
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
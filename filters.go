@@ -0,0 +1,160 @@
+package main
+
+import "sort"
+
+// taggedMessage is a message with every -filter-param stream it was seen in
+type taggedMessage struct {
+	Message
+	filters []string
+}
+
+// filterMerger merges the pages of several filtered streams into one
+// deduplicated sequence. Each stream walks IDs downward, so a message is
+// released once every active stream has paged past its ID: no stream can
+// report it again and its tags are final.
+type filterMerger struct {
+	// cursors holds the smallest ID seen per active stream, 0 before its first page
+	cursors map[string]int64
+	pending map[int64]*taggedMessage
+	// floor is the smallest ID released once every stream had paged past
+	// it, no stream can report anything at or above it again, so
+	// deduplication needs no set of every ID seen
+	floor int64
+	// early holds the IDs released early because of maxPending that a
+	// lagging stream may still report, until every stream is past them
+	early map[int64]bool
+	// maxPending bounds pending, 0 for no bound
+	maxPending int
+	// forced counts messages released early because of maxPending
+	forced int
+}
+
+func newFilterMerger(filters []string, maxPending int) *filterMerger {
+	m := &filterMerger{
+		cursors:    map[string]int64{},
+		pending:    map[int64]*taggedMessage{},
+		early:      map[int64]bool{},
+		maxPending: maxPending,
+	}
+	for _, f := range filters {
+		m.cursors[f] = 0
+	}
+	return m
+}
+
+// add records a page of the stream for filter and returns the released messages
+func (m *filterMerger) add(filter string, msgs []Message) []taggedMessage {
+	for _, msg := range msgs {
+		if cursor := m.cursors[filter]; cursor == 0 || msg.ID < cursor {
+			m.cursors[filter] = msg.ID
+		}
+		if (m.floor != 0 && msg.ID >= m.floor) || m.early[msg.ID] {
+			continue
+		}
+		if t, ok := m.pending[msg.ID]; ok {
+			if !containsString(t.filters, filter) {
+				t.filters = append(t.filters, filter)
+			}
+			continue
+		}
+		m.pending[msg.ID] = &taggedMessage{Message: msg, filters: []string{filter}}
+	}
+	return m.release()
+}
+
+// finish marks the stream for filter as ended and returns the released messages
+func (m *filterMerger) finish(filter string) []taggedMessage {
+	delete(m.cursors, filter)
+	return m.release()
+}
+
+// release returns the pending messages no active stream can report again,
+// newest first like the API orders them.
+// Beyond maxPending the newest messages are released early: they stay
+// deduplicated by their IDs, but a lagging stream can no longer add its
+// tag. Messages only a lagging stream reports are still released.
+func (m *filterMerger) release() []taggedMessage {
+	ids := make([]int64, 0, len(m.pending))
+	for id := range m.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+
+	n := 0
+	threshold, ok := m.threshold()
+	if ok {
+		for n < len(ids) && ids[n] >= threshold {
+			n++
+		}
+		for id := range m.early {
+			if id >= threshold {
+				delete(m.early, id)
+			}
+		}
+	}
+	if n > 0 && (m.floor == 0 || ids[n-1] < m.floor) {
+		m.floor = ids[n-1]
+	}
+	passed := n
+	if m.maxPending > 0 && len(ids)-n > m.maxPending {
+		m.forced += len(ids) - n - m.maxPending
+		n = len(ids) - m.maxPending
+	}
+	released := make([]taggedMessage, n)
+	for i, id := range ids[:n] {
+		t := m.pending[id]
+		sort.Strings(t.filters)
+		released[i] = *t
+		delete(m.pending, id)
+		if i >= passed {
+			m.early[id] = true
+		}
+	}
+	return released
+}
+
+// resumeFrom returns the max below which the stream for filter must go on,
+// were the run to stop once the released messages are written, so that
+// none of the messages it reported is lost: above its newest pending
+// message, or below its cursor if it has none pending. ok is false before
+// its first page and once it finished with nothing pending.
+func (m *filterMerger) resumeFrom(filter string) (max int64, ok bool) {
+	for id, t := range m.pending {
+		if id >= max && containsString(t.filters, filter) {
+			max = id + 1
+		}
+	}
+	if max == 0 {
+		max = m.cursors[filter]
+	}
+	return max, max != 0
+}
+
+// finished reports whether the stream for filter finished
+func (m *filterMerger) finished(filter string) bool {
+	_, active := m.cursors[filter]
+	return !active
+}
+
+// threshold is the ID at and above which no active stream can report a message again
+func (m *filterMerger) threshold() (int64, bool) {
+	var threshold int64
+	for _, cursor := range m.cursors {
+		if cursor == 0 {
+			return 0, false
+		}
+		if cursor > threshold {
+			threshold = cursor
+		}
+	}
+	return threshold, true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
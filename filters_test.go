@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func messages(ids ...int64) []Message {
+	msgs := make([]Message, len(ids))
+	for i, id := range ids {
+		msgs[i].ID = id
+	}
+	return msgs
+}
+
+func releasedIDs(released []taggedMessage) []int64 {
+	ids := make([]int64, len(released))
+	for i, t := range released {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+func TestFilterMergerTagsAndDeduplicates(t *testing.T) {
+	m := newFilterMerger([]string{"all", "suggested"}, 0)
+	if got := m.add("all", messages(10, 9, 8)); len(got) != 0 {
+		t.Fatalf("released %v before every stream paged", releasedIDs(got))
+	}
+	got := m.add("suggested", messages(9, 7))
+	if want := []int64{10, 9, 8}; !reflect.DeepEqual(releasedIDs(got), want) {
+		t.Fatalf("released %v, want %v", releasedIDs(got), want)
+	}
+	if want := []string{"all", "suggested"}; !reflect.DeepEqual(got[1].filters, want) {
+		t.Errorf("9 tagged %v, want %v", got[1].filters, want)
+	}
+	got = append(m.add("all", messages(8, 7, 6)), m.finish("all")...)
+	got = append(got, m.finish("suggested")...)
+	if want := []int64{7, 6}; !reflect.DeepEqual(releasedIDs(got), want) {
+		t.Fatalf("released %v, want %v", releasedIDs(got), want)
+	}
+	if m.forced != 0 {
+		t.Errorf("forced %d, want 0", m.forced)
+	}
+}
+
+// a lagging stream's message no other stream has must not be taken for a
+// duplicate of the messages -dedup-max released early
+func TestFilterMergerForcedReleaseKeepsLaggingMessages(t *testing.T) {
+	m := newFilterMerger([]string{"all", "suggested"}, 2)
+	var all []taggedMessage
+	all = append(all, m.add("all", messages(10, 9, 7, 6, 5))...)
+	if want := []int64{10, 9, 7}; !reflect.DeepEqual(releasedIDs(all), want) {
+		t.Fatalf("forced release %v, want %v", releasedIDs(all), want)
+	}
+	all = append(all, m.add("suggested", messages(9, 8))...)
+	all = append(all, m.finish("all")...)
+	all = append(all, m.finish("suggested")...)
+	ids := releasedIDs(all)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	if want := []int64{10, 9, 8, 7, 6, 5}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("released %v, want each of %v once", ids, want)
+	}
+	if m.forced != 3 {
+		t.Errorf("forced %d, want 3", m.forced)
+	}
+	if len(m.early) != 0 {
+		t.Errorf("early IDs %v kept after every stream finished", m.early)
+	}
+}
+
+func TestFilterMergerResumeFrom(t *testing.T) {
+	m := newFilterMerger([]string{"all", "suggested"}, 0)
+	resume := func(filter string, wantMax int64, wantOK bool) {
+		t.Helper()
+		if max, ok := m.resumeFrom(filter); max != wantMax || ok != wantOK {
+			t.Fatalf("resumeFrom(%s) = %d, %t, want %d, %t", filter, max, ok, wantMax, wantOK)
+		}
+	}
+	resume("all", 0, false)
+	m.add("all", messages(20, 18, 16))
+	resume("all", 21, true)
+	resume("suggested", 0, false)
+	// down to 16 is released, suggested ran ahead and holds 15 pending
+	m.add("suggested", messages(20, 17, 15))
+	resume("all", 16, true)
+	resume("suggested", 16, true)
+	// finished with 15 pending, suggested is not done until all pages past it
+	m.finish("suggested")
+	resume("suggested", 16, true)
+	m.add("all", messages(14))
+	resume("all", 14, true)
+	resume("suggested", 0, false)
+	if !m.finished("suggested") || m.finished("all") {
+		t.Fatal("finished does not match the streams finished")
+	}
+}
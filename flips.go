@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sentimentMark is an author's message with a sentiment they tagged themselves
+type sentimentMark struct {
+	ID        int64     `json:"id"`
+	Sentiment string    `json:"sentiment"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// authorSentiments holds an author's newest and oldest tagged messages seen
+type authorSentiments struct {
+	Username string        `json:"username"`
+	Newest   sentimentMark `json:"newest"`
+	Oldest   sentimentMark `json:"oldest"`
+}
+
+// flipTracker records when an author's tagged sentiment changes between
+// their consecutive tagged messages. Runs only see a range of the stream,
+// so the ends of the ranges seen before are kept in a state file and the
+// flips across ranges are found when the run is closed.
+type flipTracker struct {
+	stateName string
+	state     map[int64]*authorSentiments
+	run       map[int64]*authorSentiments
+	file      *os.File
+	writer    *csv.Writer
+	flips     int
+}
+
+func openFlipTracker(stateName, csvName string) (*flipTracker, error) {
+	t := &flipTracker{stateName: stateName, state: map[int64]*authorSentiments{}, run: map[int64]*authorSentiments{}}
+	data, err := os.ReadFile(stateName)
+	if err == nil {
+		if err := json.Unmarshal(data, &t.state); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	t.file, err = os.OpenFile(csvName, os.O_APPEND|os.O_CREATE|os.O_RDWR, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := t.file.Stat()
+	if err != nil {
+		t.file.Close()
+		return nil, err
+	}
+	t.writer = csv.NewWriter(t.file)
+	t.writer.Comma = '\t'
+	if stat.Size() == 0 {
+		t.writer.Write([]string{"Author", "OldSentiment", "NewSentiment", "OldId", "NewId", "GapSeconds"})
+	}
+	return t, nil
+}
+
+// observe follows a message, in any order, and records a flip if its
+// sentiment differs from the author's adjacent tagged message seen so far.
+// Sentiments the author did not tag are ignored.
+func (t *flipTracker) observe(msg *Message) {
+	if msg.Sentiment.Name == "" {
+		return
+	}
+	mark := sentimentMark{ID: msg.ID, Sentiment: msg.Sentiment.Name, CreatedAt: msg.CreatedAt.Time}
+	a := t.run[msg.User.ID]
+	switch {
+	case a == nil:
+		t.run[msg.User.ID] = &authorSentiments{Username: msg.User.Username, Newest: mark, Oldest: mark}
+	case mark.ID < a.Oldest.ID:
+		t.record(a.Username, mark, a.Oldest)
+		a.Oldest = mark
+	case mark.ID > a.Newest.ID:
+		t.record(a.Username, a.Newest, mark)
+		a.Newest = mark
+	}
+}
+
+// record writes a flip from old to new if their sentiments differ
+func (t *flipTracker) record(author string, old, new sentimentMark) {
+	if old.Sentiment == new.Sentiment {
+		return
+	}
+	t.flips++
+	t.writer.Write([]string{author, old.Sentiment, new.Sentiment,
+		strconv.FormatInt(old.ID, 10), strconv.FormatInt(new.ID, 10),
+		strconv.FormatInt(int64(new.CreatedAt.Sub(old.CreatedAt).Seconds()), 10)})
+}
+
+// Close records the flips between this run's range and the ones seen
+// before, then saves the state and the flips.
+func (t *flipTracker) Close() error {
+	for id, a := range t.run {
+		s := t.state[id]
+		if s == nil {
+			t.state[id] = a
+			continue
+		}
+		if a.Oldest.ID > s.Newest.ID {
+			t.record(a.Username, s.Newest, a.Oldest)
+		}
+		if a.Newest.ID < s.Oldest.ID {
+			t.record(a.Username, a.Newest, s.Oldest)
+		}
+		if a.Newest.ID > s.Newest.ID {
+			s.Newest = a.Newest
+		}
+		if a.Oldest.ID < s.Oldest.ID {
+			s.Oldest = a.Oldest
+		}
+		s.Username = a.Username
+	}
+	t.run = map[int64]*authorSentiments{}
+	t.writer.Flush()
+	if err := t.writer.Error(); err != nil {
+		t.file.Close()
+		return err
+	}
+	if err := t.file.Close(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(t.state)
+	if err != nil {
+		return err
+	}
+	tmp := t.stateName + ".tmp"
+	if err := os.WriteFile(tmp, data, fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.stateName)
+}
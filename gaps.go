@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// gapRange is a run of message IDs missing between two adjacent messages
+type gapRange struct {
+	// From and To are the IDs of the messages around the gap, From > To
+	From int64
+	To   int64
+}
+
+// Size is the number of IDs skipped
+func (g gapRange) Size() int64 {
+	return g.From - g.To - 1
+}
+
+// detectGaps returns the gaps between adjacent messages of a batch ordered newest first.
+// IDs are shared by all symbols, so small gaps are normal.
+func detectGaps(msgs []Message) []gapRange {
+	var gaps []gapRange
+	for i := 1; i < len(msgs); i++ {
+		if msgs[i-1].ID-msgs[i].ID > 1 {
+			gaps = append(gaps, gapRange{From: msgs[i-1].ID, To: msgs[i].ID})
+		}
+	}
+	return gaps
+}
+
+// outputGaps returns the gaps larger than tolerance between the messages of
+// an output file, newest first, with the messages around each gap.
+// Rows are read in any order, duplicates are ignored.
+func outputGaps(fName string, tolerance int64) ([]gapRange, map[int64]time.Time, error) {
+	file, err := os.Open(fName)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	// skips the #schema line
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	created := map[int64]time.Time{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		// the header and any unparsable row are skipped
+		id, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil || len(row) < 2 {
+			continue
+		}
+		created[id], _ = time.Parse(time.RFC3339, row[1])
+	}
+	msgs := make([]Message, 0, len(created))
+	for id := range created {
+		msgs = append(msgs, Message{ID: id})
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID > msgs[j].ID })
+	var gaps []gapRange
+	for _, gap := range detectGaps(msgs) {
+		if gap.Size() > tolerance {
+			gaps = append(gaps, gap)
+		}
+	}
+	return gaps, created, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	journalBegin  = 'B'
+	journalCommit = 'C'
+	// kind byte followed by since, max and offset as big endian int64
+	journalRecordSize = 1 + 3*8
+)
+
+// journalRecord marks the begin or the commit of one page written to the output file.
+// Since and Max are the page's ID range, Offset is the output file size before the page.
+type journalRecord struct {
+	Kind   byte
+	Since  int64
+	Max    int64
+	Offset int64
+}
+
+func (r journalRecord) marshal() []byte {
+	buf := make([]byte, journalRecordSize)
+	buf[0] = r.Kind
+	binary.BigEndian.PutUint64(buf[1:], uint64(r.Since))
+	binary.BigEndian.PutUint64(buf[9:], uint64(r.Max))
+	binary.BigEndian.PutUint64(buf[17:], uint64(r.Offset))
+	return buf
+}
+
+func unmarshalJournalRecord(buf []byte) journalRecord {
+	return journalRecord{
+		Kind:   buf[0],
+		Since:  int64(binary.BigEndian.Uint64(buf[1:])),
+		Max:    int64(binary.BigEndian.Uint64(buf[9:])),
+		Offset: int64(binary.BigEndian.Uint64(buf[17:])),
+	}
+}
+
+// journal is a write-ahead log of the pages written to the output file,
+// so that a page interrupted by a crash can be dropped on the next run.
+type journal struct {
+	f *pooledFile
+}
+
+func openJournal(name string) (*journal, error) {
+	f, err := openFiles.openFile(name, os.O_APPEND|os.O_CREATE|os.O_RDWR, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{f: f}, nil
+}
+
+// append writes a record and fsyncs it before returning
+func (j *journal) append(r journalRecord) error {
+	if _, err := j.f.Write(r.marshal()); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+func (j *journal) begin(since, max, offset int64) error {
+	return j.append(journalRecord{journalBegin, since, max, offset})
+}
+
+func (j *journal) commit(since, max, offset int64) error {
+	return j.append(journalRecord{journalCommit, since, max, offset})
+}
+
+// pending returns the page that was begun but never committed, or nil.
+// A torn record at the end of the journal is ignored.
+func (j *journal) pending() (*journalRecord, error) {
+	data, err := os.ReadFile(j.f.name)
+	if err != nil {
+		return nil, err
+	}
+	var last *journalRecord
+	for len(data) >= journalRecordSize {
+		r := unmarshalJournalRecord(data[:journalRecordSize])
+		last = &r
+		data = data[journalRecordSize:]
+	}
+	if last == nil || last.Kind == journalCommit {
+		return nil, nil
+	}
+	if last.Kind != journalBegin {
+		return nil, fmt.Errorf("corrupt journal record kind %q", last.Kind)
+	}
+	return last, nil
+}
+
+// reset empties the journal once the output is known to be consistent
+func (j *journal) reset() error {
+	if err := j.f.Truncate(0); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+func (j *journal) Close() error {
+	return j.f.Close()
+}
+
+// recoverOutput truncates the output file back to where the uncommitted page p began.
+// Every complete row past that point must belong to the page's ID range,
+// otherwise the file is left untouched. It returns the number of rows dropped.
+func recoverOutput(fName string, p journalRecord) (int, error) {
+	file, err := os.OpenFile(fName, os.O_RDWR, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if stat.Size() < p.Offset {
+		return 0, fmt.Errorf("%s is shorter than journal offset %d", fName, p.Offset)
+	}
+	tail := make([]byte, stat.Size()-p.Offset)
+	if _, err := file.ReadAt(tail, p.Offset); err != nil {
+		return 0, err
+	}
+	// rows never span lines, anything after the last newline is a torn row
+	complete := tail[:bytes.LastIndexByte(tail, '\n')+1]
+	reader := csv.NewReader(bytes.NewReader(complete))
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse rows of uncommitted page: %s", err)
+	}
+	for _, row := range rows {
+		id, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil || id < p.Max || id > p.Since {
+			return 0, fmt.Errorf("row %q is outside uncommitted page %d - %d", row[0], p.Since, p.Max)
+		}
+	}
+	if err := file.Truncate(p.Offset); err != nil {
+		return 0, err
+	}
+	return len(rows), file.Sync()
+}
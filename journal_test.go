@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// page returns the output rows of the IDs from since down to max
+func page(since, max int64) string {
+	var b strings.Builder
+	for id := since; id >= max; id-- {
+		n := strconv.FormatInt(id, 10)
+		b.WriteString(strings.Join([]string{n, "2024-01-02T03:04:05Z", "body of " + n}, "\t"))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// crashedRun writes two pages to the output and journals them as the
+// scraper does, then simulates a crash cut inside the second page, cut
+// bytes before its end. It returns the output and journal names and the
+// offset the second page began at.
+func crashedRun(t *testing.T, cut int) (string, string, int64) {
+	dir := t.TempDir()
+	fName, jName := filepath.Join(dir, "AAPL.csv"), filepath.Join(dir, "AAPL.journal")
+	head := "#schema:v3\nId\tCreatedAt\tBody\n"
+	first, second := page(1020, 1011), page(1010, 1001)
+	j, err := openJournal(jName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := int64(len(head))
+	if err := j.begin(1020, 1011, offset); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.commit(1020, 1011, offset); err != nil {
+		t.Fatal(err)
+	}
+	offset += int64(len(first))
+	if err := j.begin(1010, 1001, offset); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the crash leaves the second page partly written and never committed
+	if err := os.WriteFile(fName, []byte(head+first+second[:len(second)-cut]), fileMode); err != nil {
+		t.Fatal(err)
+	}
+	return fName, jName, offset
+}
+
+func TestJournalRecoversPageCutMidRow(t *testing.T) {
+	fName, jName, offset := crashedRun(t, 7)
+	j, err := openJournal(jName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	p, err := j.pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == nil || p.Since != 1010 || p.Max != 1001 || p.Offset != offset {
+		t.Fatalf("pending = %+v, want the page 1010 - 1001 at %d", p, offset)
+	}
+	n, err := recoverOutput(fName, *p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last row is torn, the nine before it are complete
+	if n != 9 {
+		t.Fatalf("dropped %d rows, want 9", n)
+	}
+	data, err := os.ReadFile(fName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "#schema:v3\nId\tCreatedAt\tBody\n" + page(1020, 1011); string(data) != want {
+		t.Fatalf("recovered output:\n%s\nwant:\n%s", data, want)
+	}
+	if err := j.reset(); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := j.pending(); err != nil || p != nil {
+		t.Fatalf("pending after reset = %+v, %v, want nothing", p, err)
+	}
+}
+
+func TestJournalRecoversPageCutOnRowBoundary(t *testing.T) {
+	fName, jName, offset := crashedRun(t, len(page(1003, 1001)))
+	j, err := openJournal(jName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	p, err := j.pending()
+	if err != nil || p == nil {
+		t.Fatalf("pending = %+v, %v, want the second page", p, err)
+	}
+	if n, err := recoverOutput(fName, *p); err != nil || n != 7 {
+		t.Fatalf("recoverOutput = %d, %v, want 7 rows dropped", n, err)
+	}
+	if stat, err := os.Stat(fName); err != nil || stat.Size() != offset {
+		t.Fatalf("output is %v bytes, want %d", stat.Size(), offset)
+	}
+}
+
+func TestJournalIgnoresTornRecord(t *testing.T) {
+	_, jName, _ := crashedRun(t, 0)
+	// cut the begin record of the second page in half, as if the crash
+	// came while it was written: the first page is all that happened
+	stat, err := os.Stat(jName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(jName, stat.Size()-journalRecordSize/2); err != nil {
+		t.Fatal(err)
+	}
+	j, err := openJournal(jName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if p, err := j.pending(); err != nil || p != nil {
+		t.Fatalf("pending = %+v, %v, want nothing past the committed page", p, err)
+	}
+}
+
+func TestRecoverOutputRefusesForeignRows(t *testing.T) {
+	fName, _, offset := crashedRun(t, 0)
+	// a row outside the uncommitted page means the offset is not to be
+	// trusted, the file must be left as is
+	p := journalRecord{Kind: journalBegin, Since: 1005, Max: 1001, Offset: offset}
+	if _, err := recoverOutput(fName, p); err == nil {
+		t.Fatal("recoverOutput dropped rows outside the page")
+	}
+	if stat, err := os.Stat(fName); err != nil || stat.Size() == offset {
+		t.Fatal("the output was truncated despite the error")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// scrapeLifecycle tracks the streams of a scrape until every one has
+// ended. Unlike a sync.WaitGroup, a Finish without a matching Begin is
+// logged and ignored instead of panicking, and Wait returns at once if
+// nothing was begun.
+type scrapeLifecycle struct {
+	active atomic.Int64
+	begun  atomic.Bool
+	done   chan struct{}
+	close  sync.Once
+}
+
+func newScrapeLifecycle() *scrapeLifecycle {
+	return &scrapeLifecycle{done: make(chan struct{})}
+}
+
+// Begin counts a stream in
+func (l *scrapeLifecycle) Begin() {
+	l.begun.Store(true)
+	l.active.Add(1)
+}
+
+// Finish counts a stream out, releasing Wait after the last one
+func (l *scrapeLifecycle) Finish() {
+	for {
+		n := l.active.Load()
+		if n <= 0 {
+			logger.Printf("WARNING: a stream finished more often than it began, ignored\n")
+			return
+		}
+		if l.active.CompareAndSwap(n, n-1) {
+			if n == 1 {
+				l.close.Do(func() { close(l.done) })
+			}
+			return
+		}
+	}
+}
+
+// Wait blocks until every stream begun has finished
+func (l *scrapeLifecycle) Wait() {
+	if !l.begun.Load() {
+		return
+	}
+	<-l.done
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// runMeta describes one run that wrote to an output file
+type runMeta struct {
+	Version    string            `json:"version"`
+	Config     map[string]string `json:"config"`
+	StartedAt  time.Time         `json:"started_at"`
+	EndedAt    time.Time         `json:"ended_at"`
+	StopReason string            `json:"stop_reason"`
+	Rows       int               `json:"rows"`
+	// AcknowledgedTerms is set when -ack-file was checked before the run
+	AcknowledgedTerms bool `json:"acknowledged_terms"`
+	// Stages is the time spent per pipeline stage, see stageTimings
+	Stages map[string]stageTiming `json:"stages,omitempty"`
+}
+
+// metaFile is the SYMBOL.meta.json sidecar, the latest run first
+// and the previous ones in History, oldest first.
+type metaFile struct {
+	Symbol  string    `json:"symbol"`
+	LastRun runMeta   `json:"last_run"`
+	History []runMeta `json:"history"`
+}
+
+// toolVersion returns the module version and VCS revision the binary was built from
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			version += " " + s.Value
+		}
+	}
+	return version
+}
+
+// writeRunMeta records run in the sidecar name, moving the previous run to the history.
+// The file is replaced atomically.
+func writeRunMeta(name string, symbol string, run runMeta) error {
+	meta := metaFile{}
+	data, err := os.ReadFile(name)
+	if err == nil {
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return err
+		}
+		meta.History = append(meta.History, meta.LastRun)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	meta.Symbol = symbol
+	meta.LastRun = run
+	data, err = json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
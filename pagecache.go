@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// pageCache serves the symbol page from colly's cache directory for ttl,
+// so that runs close together skip the visit. colly caches every GET of a
+// collector and never expires its files, so the cache is set for the page
+// visit only and a file older than ttl is removed before it.
+type pageCache struct {
+	dir string
+	ttl time.Duration
+	url string
+}
+
+func newPageCache(dir string, ttl time.Duration, pageURL string) *pageCache {
+	// colly keys its files by the URL of the request, parsed
+	if u, err := url.Parse(pageURL); err == nil {
+		pageURL = u.String()
+	}
+	return &pageCache{dir: dir, ttl: ttl, url: pageURL}
+}
+
+// path returns the file colly caches the page in
+func (p *pageCache) path() string {
+	sum := sha1.Sum([]byte(p.url))
+	hash := hex.EncodeToString(sum[:])
+	return filepath.Join(p.dir, hash[:2], hash)
+}
+
+// visit visits the page with c, through the cache
+func (p *pageCache) visit(c *colly.Collector) error {
+	if stat, err := os.Stat(p.path()); err == nil {
+		if age := time.Since(stat.ModTime()); age > p.ttl {
+			if err := os.Remove(p.path()); err != nil {
+				logger.Printf("WARNING: cannot remove the stale cached symbol page: %s\n", err)
+			}
+		} else {
+			logger.Printf("symbol page cached %s ago in %s\n", age.Round(time.Second), p.dir)
+		}
+	}
+	c.CacheDir = p.dir
+	defer func() { c.CacheDir = "" }()
+	return c.Visit(p.url)
+}
+
+// invalidate removes the cached page, a 403 may mean its token was refused
+func (p *pageCache) invalidate() {
+	if err := os.Remove(p.path()); err == nil {
+		logger.Printf("removed the cached symbol page after a 403 response\n")
+	}
+}
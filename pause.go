@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// pauseHeartbeat is how often a paused run says so in the log
+const pauseHeartbeat = time.Minute
+
+// pauser holds back new requests while paused, the page in flight is still written
+type pauser struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	paused bool
+	since  time.Time
+}
+
+func newPauser() *pauser {
+	p := &pauser{}
+	p.cond = sync.NewCond(&p.mutex)
+	return p
+}
+
+// toggle pauses or resumes and logs the new state, with a heartbeat while paused
+func (p *pauser) toggle() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.paused = !p.paused
+	if !p.paused {
+		logger.Printf("resumed after a pause of %s\n", time.Since(p.since).Round(time.Second))
+		p.cond.Broadcast()
+		return
+	}
+	p.since = time.Now()
+	logger.Println("paused, no new requests until resumed")
+	go p.heartbeat(p.since)
+}
+
+// heartbeat logs every pauseHeartbeat until the pause started at since ends
+func (p *pauser) heartbeat(since time.Time) {
+	ticker := time.NewTicker(pauseHeartbeat)
+	defer ticker.Stop()
+	for range ticker.C {
+		p.mutex.Lock()
+		paused := p.paused && p.since == since
+		p.mutex.Unlock()
+		if !paused {
+			return
+		}
+		logger.Printf("still paused, for %s\n", time.Since(since).Round(time.Second))
+	}
+}
+
+// wait blocks while paused
+func (p *pauser) wait() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for p.paused {
+		p.cond.Wait()
+	}
+}
+
+// handlePauseSignal toggles p on every pause signal, where the platform has one
+func handlePauseSignal(p *pauser) {
+	if pauseSignal == nil {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, pauseSignal)
+	p.follow(signals)
+}
+
+// follow toggles p on every signal received from signals until it is closed
+func (p *pauser) follow(signals <-chan os.Signal) {
+	go func() {
+		for range signals {
+			p.toggle()
+		}
+	}()
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// pauseSignal is nil where there is no SIGUSR1
+var pauseSignal os.Signal
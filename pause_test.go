@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// isPaused reports whether p holds back requests
+func (p *pauser) isPaused() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.paused
+}
+
+// awaitPaused waits for p to be paused or not, as signals are handled asynchronously
+func awaitPaused(t *testing.T, p *pauser, paused bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for p.isPaused() != paused {
+		if time.Now().After(deadline) {
+			t.Fatalf("pause state did not become %t", paused)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPauseSignalHoldsBackPolls(t *testing.T) {
+	quietLogger(t)
+	saved := pause
+	pause = newPauser()
+	t.Cleanup(func() { pause = saved })
+	signals := make(chan os.Signal, 1)
+	defer close(signals)
+	pause.follow(signals)
+
+	server := &benchServer{perPage: 5, pages: 4, start: time.Now().UTC()}
+	var polls atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/streams/") && polls.Add(1) == 2 {
+			// the signal comes while the second page is being served, any
+			// signal will do as the channel is not the process's
+			signals <- os.Interrupt
+			awaitPaused(t, pause, true)
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	cfg, err := defaultConfig(t).forFixture(t.TempDir(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- scrape(cfg) }()
+
+	awaitPaused(t, pause, true)
+	// the page in flight is written, but no new poll goes out
+	time.Sleep(300 * time.Millisecond)
+	if n := polls.Load(); n != 2 {
+		t.Fatalf("%d polls sent while paused after the second", n)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("scrape returned while paused: %v", err)
+	default:
+	}
+
+	signals <- os.Interrupt
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("scrape did not finish once resumed")
+	}
+	// the four pages and the empty one after them
+	if n := polls.Load(); n != 5 {
+		t.Fatalf("%d polls in all, want 5", n)
+	}
+	if rows := countRows(t, cfg.outputPath(".csv")); rows != 20 {
+		t.Fatalf("%d rows written, want every one of 20", rows)
+	}
+}
+
+// countRows returns the rows of an output file, less the #schema line and the header
+func countRows(t *testing.T, name string) int {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n") - 2
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignal toggles pausing, kill -USR1 <pid>
+var pauseSignal os.Signal = syscall.SIGUSR1
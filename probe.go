@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// pageProbe follows a stream's first pages to estimate how many
+// more are needed to page back to the -date window.
+type pageProbe struct {
+	pages  int
+	newest time.Time
+	oldest time.Time
+}
+
+// observe records a page ordered newest first
+func (p *pageProbe) observe(msgs []Message) {
+	if len(msgs) == 0 {
+		return
+	}
+	if p.pages == 0 {
+		p.newest = msgs[0].CreatedAt.Time
+	}
+	p.pages++
+	p.oldest = msgs[len(msgs)-1].CreatedAt.Time
+}
+
+// remaining estimates the pages left until the stream reaches until,
+// extrapolating the time span covered by the pages so far.
+func (p *pageProbe) remaining(until time.Time) (int, bool) {
+	span := p.newest.Sub(p.oldest)
+	if p.pages == 0 || span <= 0 {
+		return 0, false
+	}
+	perPage := span / time.Duration(p.pages)
+	return int(math.Ceil(float64(p.oldest.Sub(until)) / float64(perPage))), true
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// randomRead fills request IDs, replaced in tests
+var randomRead = rand.Read
+
+// fallbackIDs numbers the request IDs made while randomRead fails, after
+// the start of the process so that they differ from one run to the next
+var (
+	fallbackStart = time.Now().UnixNano()
+	fallbackIDs   atomic.Int64
+)
+
+// newRequestID returns a random UUID version 4, or a counter-based ID if
+// the random source fails, which should not fail the request
+func newRequestID() string {
+	var b [16]byte
+	if _, err := randomRead(b[:]); err != nil {
+		return fmt.Sprintf("%x-%d", fallbackStart, fallbackIDs.Add(1))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// requestIDSuffix returns " (request ID <id>)" for the latest attempt of
+// the request of ctx, or "" without -request-id-header
+func requestIDSuffix(ctx *colly.Context) string {
+	if id := ctx.Get("requestID"); id != "" {
+		return fmt.Sprintf(" (request ID %s)", id)
+	}
+	return ""
+}
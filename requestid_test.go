@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestNewRequestID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if id := newRequestID(); !uuid.MatchString(id) {
+		t.Fatalf("newRequestID() = %q, want a UUID version 4", id)
+	}
+
+	defer func(read func([]byte) (int, error)) { randomRead = read }(randomRead)
+	randomRead = func([]byte) (int, error) { return 0, errors.New("no entropy") }
+	first, second := newRequestID(), newRequestID()
+	if first == "" || first == second {
+		t.Fatalf("newRequestID() without a random source = %q then %q, want distinct IDs", first, second)
+	}
+}
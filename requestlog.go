@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+	"github.com/gocolly/colly/debug"
+)
+
+// requestLog is a debug.Debugger writing one key=value line per collector event
+// to its own file, keeping network diagnostics out of the main log.
+type requestLog struct {
+	mutex sync.Mutex
+	out   io.WriteCloser
+	// started holds the time of each request in flight
+	started map[requestKey]time.Time
+}
+
+// requestKey identifies a request, IDs are only unique per collector
+type requestKey struct {
+	collector, request uint32
+}
+
+// openRequestLog truncates name, a log covers one run
+func openRequestLog(name string) (*requestLog, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	return &requestLog{out: f, started: map[requestKey]time.Time{}}, nil
+}
+
+// Init implements debug.Debugger.
+func (l *requestLog) Init() error {
+	return nil
+}
+
+// Event implements debug.Debugger.
+func (l *requestLog) Event(e *debug.Event) {
+	keys := make([]string, 0, len(e.Values))
+	for k := range e.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		fields = append(fields, fmt.Sprintf("%s=%q", k, e.Values[k]))
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	key := requestKey{e.CollectorID, e.RequestID}
+	switch e.Type {
+	case "request":
+		l.started[key] = now
+	case "response", "error":
+		if start, ok := l.started[key]; ok {
+			fields = append(fields, fmt.Sprintf("elapsed=%s", now.Sub(start)))
+			delete(l.started, key)
+		}
+	}
+	fmt.Fprintf(l.out, "%s event=%s req=%d collector=%d %s\n",
+		now.Format(time.RFC3339Nano), e.Type, e.RequestID, e.CollectorID, strings.Join(fields, " "))
+}
+
+// attach makes l the debugger of c and adds the status code and size of every
+// response, which debug events do not carry.
+func (l *requestLog) attach(c *colly.Collector) {
+	c.SetDebugger(l)
+	body := func(r *colly.Response) {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		fmt.Fprintf(l.out, "%s event=body req=%d url=%q code=%d bytes=%d\n",
+			time.Now().Format(time.RFC3339Nano), r.Request.ID, r.Request.URL, r.StatusCode, len(r.Body))
+	}
+	c.OnResponse(body)
+	c.OnError(func(r *colly.Response, err error) { body(r) })
+}
+
+func (l *requestLog) Close() error {
+	return l.out.Close()
+}
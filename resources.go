@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteSize is a flag.Value for sizes like 512MB or 1GB, 0 disables a guard
+type byteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+func (b *byteSize) String() string {
+	for _, u := range byteUnits {
+		if *b != 0 && int64(*b)%u.size == 0 {
+			return fmt.Sprintf("%d%s", int64(*b)/u.size, u.suffix)
+		}
+	}
+	return "0"
+}
+
+// Set implements the flag.Value interface.
+func (b *byteSize) Set(s string) error {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSuffix(s, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("want a size like 512MB or 1GB, got %q", s)
+	}
+	*b = byteSize(n * unit)
+	return nil
+}
+
+// resourceGuard pauses scraping when the disk is nearly full and
+// flushes early when the process uses too much memory. The open files
+// are capped by openFiles, files tells how often those of this symbol
+// were reopened.
+type resourceGuard struct {
+	dir         string
+	minFreeDisk int64
+	maxMemory   int64
+	// probes, replaceable by fakes
+	freeDisk func(dir string) (int64, error)
+	rss      func() (int64, error)
+	sleep    func(time.Duration)
+	files    []*pooledFile
+	// activations, reported in the run summary
+	diskPauses    int
+	memoryFlushes int
+}
+
+func newResourceGuard(dir string, minFreeDisk, maxMemory int64) *resourceGuard {
+	return &resourceGuard{
+		dir:         dir,
+		minFreeDisk: minFreeDisk,
+		maxMemory:   maxMemory,
+		freeDisk:    freeDiskSpace,
+		rss:         residentMemory,
+		sleep:       time.Sleep,
+	}
+}
+
+// waitForDisk blocks while the free space is below minFreeDisk
+func (g *resourceGuard) waitForDisk() {
+	if g.minFreeDisk == 0 {
+		return
+	}
+	paused := false
+	for {
+		free, err := g.freeDisk(g.dir)
+		if err != nil {
+			logger.Printf("WARNING: cannot check free disk space: %s\n", err)
+			return
+		}
+		if free >= g.minFreeDisk {
+			if paused {
+				logger.Printf("free disk space is %d bytes, resuming\n", free)
+			}
+			return
+		}
+		if !paused {
+			paused = true
+			g.diskPauses++
+		}
+		logger.Printf("WARNING: only %d bytes free in %q, below -min-free-disk %d, scraping paused\n",
+			free, g.dir, g.minFreeDisk)
+		g.sleep(30 * time.Second)
+	}
+}
+
+// checkMemory calls flush and returns memory to the OS when RSS is above maxMemory
+func (g *resourceGuard) checkMemory(flush func()) {
+	if g.maxMemory == 0 {
+		return
+	}
+	rss, err := g.rss()
+	if err != nil {
+		logger.Printf("WARNING: cannot check memory usage: %s\n", err)
+		return
+	}
+	if rss <= g.maxMemory {
+		return
+	}
+	g.memoryFlushes++
+	logger.Printf("WARNING: resident memory %d bytes is above -max-memory %d, flushing\n", rss, g.maxMemory)
+	flush()
+	debug.FreeOSMemory()
+}
+
+func (g *resourceGuard) summary() string {
+	reopens := 0
+	for _, f := range g.files {
+		reopens += f.reopened()
+	}
+	return fmt.Sprintf("disk pauses %d, memory flushes %d, file reopens %d", g.diskPauses, g.memoryFlushes, reopens)
+}
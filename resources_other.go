@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+func freeDiskSpace(dir string) (int64, error) {
+	return 0, errors.New("not supported on " + runtime.GOOS)
+}
+
+// residentMemory approximates the resident set size by the memory obtained from the OS
+func residentMemory() (int64, error) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return int64(m.Sys), nil
+}
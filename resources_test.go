@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWaitForDiskPausesUntilSpaceIsFree(t *testing.T) {
+	quietLogger(t)
+	free := []int64{100, 200, 5000}
+	g := newResourceGuard("/out", 1000, 0)
+	g.freeDisk = func(dir string) (int64, error) {
+		n := free[0]
+		free = free[1:]
+		return n, nil
+	}
+	var slept []time.Duration
+	g.sleep = func(d time.Duration) { slept = append(slept, d) }
+	g.waitForDisk()
+	if len(free) != 0 || len(slept) != 2 {
+		t.Fatalf("checked until %v left, slept %v, want every probe and two sleeps", free, slept)
+	}
+	// one low disk episode is one pause, however long
+	if g.diskPauses != 1 {
+		t.Fatalf("diskPauses = %d, want 1", g.diskPauses)
+	}
+	g.freeDisk = func(string) (int64, error) { return 0, errors.New("statfs failed") }
+	g.waitForDisk()
+	if g.diskPauses != 1 {
+		t.Fatalf("a failed probe paused, diskPauses = %d", g.diskPauses)
+	}
+}
+
+func TestCheckMemoryFlushesAboveLimit(t *testing.T) {
+	quietLogger(t)
+	g := newResourceGuard("/out", 0, 1<<20)
+	flushes := 0
+	for _, rss := range []int64{1 << 19, 1 << 20, 2 << 20, 1 << 19, 3 << 20} {
+		g.rss = func() (int64, error) { return rss, nil }
+		g.checkMemory(func() { flushes++ })
+	}
+	if flushes != 2 || g.memoryFlushes != 2 {
+		t.Fatalf("flushed %d times, counted %d, want 2", flushes, g.memoryFlushes)
+	}
+}
+
+// limitedOpener is os.OpenFile failing with EMFILE beyond limit files
+// open through it, as the process fd limit would
+func limitedOpener(t *testing.T, limit int) (func(string, int, os.FileMode) (*os.File, error), func() int) {
+	var files []*os.File
+	open := func() int {
+		n := 0
+		for _, f := range files {
+			// a closed file fails Fd with an invalid descriptor
+			if f.Fd() != ^uintptr(0) {
+				n++
+			}
+		}
+		return n
+	}
+	return func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		if open() >= limit {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EMFILE}
+		}
+		f, err := os.OpenFile(name, flag, perm)
+		if err == nil {
+			files = append(files, f)
+			t.Cleanup(func() { f.Close() })
+		}
+		return f, err
+	}, open
+}
+
+func TestFilePoolStaysUnderFileLimit(t *testing.T) {
+	dir := t.TempDir()
+	const limit = 2
+	open, count := limitedOpener(t, limit)
+
+	// without a cap the third file hits the fd limit
+	unlimited := newFilePool(0)
+	unlimited.open = open
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		var f *pooledFile
+		if f, err = unlimited.openFile(filepath.Join(dir, "u"+string(rune('a'+i))), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+			defer f.Close()
+		}
+	}
+	if !errors.Is(err, syscall.EMFILE) {
+		t.Fatalf("opening 3 files under a limit of %d: %v, want EMFILE", limit, err)
+	}
+
+	open, count = limitedOpener(t, limit)
+	pool := newFilePool(limit)
+	pool.open = open
+	var files []*pooledFile
+	for _, name := range []string{"AAPL.csv", "TSLA.csv", "MSFT.csv"} {
+		f, err := pool.openFile(filepath.Join(dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("open %s: %s", name, err)
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	// every symbol writes in turn, each write reopening a closed file
+	for round := 0; round < 3; round++ {
+		for _, f := range files {
+			if _, err := f.Write([]byte(filepath.Base(f.name) + "\n")); err != nil {
+				t.Fatalf("write %s: %s", f.name, err)
+			}
+			if err := f.Sync(); err != nil {
+				t.Fatalf("sync %s: %s", f.name, err)
+			}
+			if n := pool.openFiles(); n > limit || count() > limit {
+				t.Fatalf("%d files open in the pool, %d in all, want at most %d", n, count(), limit)
+			}
+		}
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := filepath.Base(f.name) + "\n"
+		if string(data) != line+line+line {
+			t.Fatalf("%s holds %q, want 3 lines, the appends of a reopened file are kept", f.name, data)
+		}
+		if f.reopened() == 0 {
+			t.Fatalf("%s was never reopened", f.name)
+		}
+	}
+}
+
+func TestFilePoolKeepsBusyFilesOpen(t *testing.T) {
+	dir := t.TempDir()
+	pool := newFilePool(1)
+	a, err := pool.openFile(filepath.Join(dir, "a"), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	file, err := a.acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pool.openFile(filepath.Join(dir, "b"), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	// a is in use, opening b may not close it
+	if _, err := file.Write([]byte("x")); err != nil {
+		t.Fatalf("the busy file was closed: %s", err)
+	}
+	// released, a is the least recently used and closed
+	a.release()
+	if n := pool.openFiles(); n != 1 || a.file != nil {
+		t.Fatalf("%d files open once released, want 1", n)
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := map[string]int64{"0": 0, "512": 512, "512MB": 512 << 20, "1gb": 1 << 30, " 2 TB ": 2 << 40}
+	for s, want := range tests {
+		var b byteSize
+		if err := b.Set(s); err != nil || int64(b) != want {
+			t.Errorf("Set(%q) = %d, %v, want %d", s, b, err, want)
+		}
+	}
+	for _, s := range []string{"", "-1GB", "lots", "1.5GB"} {
+		var b byteSize
+		if err := b.Set(s); err == nil {
+			t.Errorf("Set(%q) succeeded", s)
+		}
+	}
+}
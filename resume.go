@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// resumeTarget is an existing output file to bring up to date
+type resumeTarget struct {
+	symbol   string
+	latestID int64
+}
+
+// resumeTargets lists the SYMBOL.csv files in dir with their newest message ID
+func resumeTargets(dir string) ([]resumeTarget, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	var targets []resumeTarget
+	for _, name := range names {
+		symbol := strings.TrimSuffix(filepath.Base(name), ".csv")
+		// skip sidecars such as SYMBOL.batches.csv or SYMBOL.day.csv
+		if strings.Contains(symbol, ".") && isSidecar(symbol[strings.LastIndexByte(symbol, '.')+1:]) {
+			continue
+		}
+		id, err := latestID(name)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, resumeTarget{symbol: symbol, latestID: id})
+	}
+	return targets, nil
+}
+
+// latestID returns the largest message ID in an output file, 0 if it has no rows
+func latestID(fName string) (int64, error) {
+	file, err := os.Open(fName)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	// skips the #schema line
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var latest int64
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return latest, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		// the header and any unparsable row are skipped
+		if id, err := strconv.ParseInt(row[0], 10, 64); err == nil && id > latest {
+			latest = id
+		}
+	}
+}
+
+// isSidecar reports whether a SYMBOL.suffix.csv file is a sidecar rather than an output file
+func isSidecar(suffix string) bool {
+	_, aggregate := aggregateBuckets[suffix]
+	return suffix == "batches" || suffix == "flips" || suffix == "roster" || aggregate
+}
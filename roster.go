@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// rosterAuthor is what is known of an author of a symbol's messages
+type rosterAuthor struct {
+	Username       string    `json:"username"`
+	FirstMessageID int64     `json:"first_message_id"`
+	FirstSeenAt    time.Time `json:"first_seen_at"`
+	LastSeenAt     time.Time `json:"last_seen_at"`
+	Messages       int       `json:"messages"`
+	Likes          int       `json:"likes"`
+}
+
+// idSpan is a range of message IDs, From <= To
+type idSpan struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// rosterState is the SYMBOL.roster.json file
+type rosterState struct {
+	// Counted are the ID spans whose messages are in Authors. A run pages
+	// through a contiguous span of the stream, so a few spans cover it all.
+	Counted []idSpan                `json:"counted"`
+	Authors map[int64]*rosterAuthor `json:"authors"`
+}
+
+// rosterTracker keeps the authors of a symbol with their first and last
+// message. Messages in a span counted by an earlier run are skipped, so a
+// message is counted once however often it is scraped. The state is saved
+// every -checkpoint-interval and at the end of the run, not per page, as
+// it grows with the authors. The counts and spans are saved together, so
+// a crash loses both for the messages since the last save, which the next
+// run counts again.
+type rosterTracker struct {
+	stateName string
+	csvName   string
+	state     rosterState
+	// counted are the spans of earlier runs, run the span of this one
+	counted []idSpan
+	run     idSpan
+}
+
+func openRosterTracker(stateName, csvName string) (*rosterTracker, error) {
+	t := &rosterTracker{stateName: stateName, csvName: csvName, state: rosterState{Authors: map[int64]*rosterAuthor{}}}
+	data, err := os.ReadFile(stateName)
+	if err == nil {
+		if err := json.Unmarshal(data, &t.state); err != nil {
+			return nil, err
+		}
+		if t.state.Authors == nil {
+			t.state.Authors = map[int64]*rosterAuthor{}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	t.counted = t.state.Counted
+	return t, nil
+}
+
+// observe counts msg for its author unless an earlier run counted it.
+// Messages come newest first within a page but pages may come in any order.
+func (t *rosterTracker) observe(msg *Message) {
+	for _, s := range t.counted {
+		if msg.ID >= s.From && msg.ID <= s.To {
+			return
+		}
+	}
+	if t.run.From == 0 || msg.ID < t.run.From {
+		t.run.From = msg.ID
+	}
+	if msg.ID > t.run.To {
+		t.run.To = msg.ID
+	}
+	at := msg.CreatedAt.Time
+	a := t.state.Authors[msg.User.ID]
+	if a == nil {
+		a = &rosterAuthor{FirstMessageID: msg.ID, FirstSeenAt: at, LastSeenAt: at}
+		t.state.Authors[msg.User.ID] = a
+	}
+	a.Username = msg.User.Username
+	if msg.ID < a.FirstMessageID {
+		a.FirstMessageID, a.FirstSeenAt = msg.ID, at
+	}
+	if at.After(a.LastSeenAt) {
+		a.LastSeenAt = at
+	}
+	a.Messages++
+	a.Likes += msg.TotalLikes
+}
+
+// save replaces the state file with the authors and the spans counted so far
+func (t *rosterTracker) save() error {
+	t.state.Counted = t.counted
+	if t.run.To != 0 {
+		t.state.Counted = mergeSpans(append(append([]idSpan(nil), t.counted...), t.run))
+	}
+	data, err := json.Marshal(t.state)
+	if err != nil {
+		return err
+	}
+	tmp := t.stateName + ".tmp"
+	if err := os.WriteFile(tmp, data, fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.stateName)
+}
+
+// Close saves the state and rewrites the roster CSV, one row per author
+func (t *rosterTracker) Close() error {
+	if err := t.save(); err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(t.state.Authors))
+	for id := range t.state.Authors {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = '\t'
+	writer.Write([]string{"AuthorId", "Username", "FirstMessageId", "FirstSeenAt", "LastSeenAt", "Messages", "Likes"})
+	for _, id := range ids {
+		a := t.state.Authors[id]
+		writer.Write([]string{strconv.FormatInt(id, 10), a.Username, strconv.FormatInt(a.FirstMessageID, 10),
+			a.FirstSeenAt.Format(time.RFC3339), a.LastSeenAt.Format(time.RFC3339),
+			strconv.Itoa(a.Messages), strconv.Itoa(a.Likes)})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	tmp := t.csvName + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.csvName)
+}
+
+// mergeSpans returns spans sorted with the overlapping ones merged
+func mergeSpans(spans []idSpan) []idSpan {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].From < spans[j].From })
+	var merged []idSpan
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.From <= merged[n-1].To+1 {
+			if s.To > merged[n-1].To {
+				merged[n-1].To = s.To
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
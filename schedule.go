@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scheduleFlags collects repeated -delay-schedule windows
+type scheduleFlags []string
+
+// String implements the flag.Value interface.
+func (s *scheduleFlags) String() string {
+	return strings.Join(*s, "; ")
+}
+
+// Set implements the flag.Value interface.
+func (s *scheduleFlags) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// delayWindow multiplies the delay between polls by factor on days from
+// start to end minutes past midnight. A window with end before start runs
+// past midnight, the days being those it starts on.
+type delayWindow struct {
+	spec       string
+	days       [7]bool
+	start, end int
+	factor     float64
+}
+
+// parseDelayWindow parses "DAYS HH:MM-HH:MM FACTOR", DAYS being daily or a
+// comma separated list of days and day ranges such as mon-fri or sat,sun
+func parseDelayWindow(spec string) (delayWindow, error) {
+	w := delayWindow{spec: spec}
+	fields := strings.Fields(spec)
+	if len(fields) != 3 {
+		return w, fmt.Errorf("want \"DAYS HH:MM-HH:MM FACTOR\", got %q", spec)
+	}
+	if err := w.parseDays(strings.ToLower(fields[0])); err != nil {
+		return w, fmt.Errorf("%q: %s", spec, err)
+	}
+	from, to, ok := strings.Cut(fields[1], "-")
+	var err error
+	if !ok {
+		return w, fmt.Errorf("%q: want a time range like 09:30-16:00", spec)
+	}
+	if w.start, err = minuteOfDay(from); err != nil {
+		return w, fmt.Errorf("%q: %s", spec, err)
+	}
+	if w.end, err = minuteOfDay(to); err != nil {
+		return w, fmt.Errorf("%q: %s", spec, err)
+	}
+	w.factor, err = strconv.ParseFloat(strings.TrimPrefix(fields[2], "x"), 64)
+	if err != nil || w.factor <= 0 {
+		return w, fmt.Errorf("%q: factor %s must be a positive number", spec, fields[2])
+	}
+	return w, nil
+}
+
+func (w *delayWindow) parseDays(days string) error {
+	if days == "daily" {
+		for d := range w.days {
+			w.days[d] = true
+		}
+		return nil
+	}
+	for _, part := range strings.Split(days, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return fmt.Errorf("unknown day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return fmt.Errorf("unknown day %q", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// minuteOfDay parses HH:MM, 24:00 being the end of the day
+func minuteOfDay(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// contains tells whether t, in the schedule's time zone, falls in w
+func (w *delayWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+	if minute >= w.start {
+		return w.days[t.Weekday()]
+	}
+	return minute < w.end && w.days[(t.Weekday()+6)%7]
+}
+
+// delaySchedule scales the delay between polls by the first of its windows
+// the current time falls in, logging every change of factor
+type delaySchedule struct {
+	windows []delayWindow
+	loc     *time.Location
+	mutex   sync.Mutex
+	current float64
+}
+
+func newDelaySchedule(specs []string, tz string) (*delaySchedule, error) {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+	s := &delaySchedule{loc: loc, current: 1}
+	for _, spec := range specs {
+		w, err := parseDelayWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+// scale returns delay scaled for the time now
+func (s *delaySchedule) scale(delay time.Duration, now time.Time) time.Duration {
+	factor, spec := 1.0, "outside the -delay-schedule windows"
+	now = now.In(s.loc)
+	for i := range s.windows {
+		if s.windows[i].contains(now) {
+			factor, spec = s.windows[i].factor, "in window "+s.windows[i].spec
+			break
+		}
+	}
+	s.mutex.Lock()
+	if factor != s.current {
+		logger.Printf("delay between polls is now %g times -delay, %s\n", factor, spec)
+		s.current = factor
+	}
+	s.mutex.Unlock()
+	return time.Duration(float64(delay) * factor)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outputSchema is the version of the output columns, written as the
+// #schema:vN line that starts a new output file. Bump it whenever a
+// column changes meaning or place. Files without the line were written
+// before it and are version 1; version 2 added UserType after Likes and
+// version 3 SuspectTS after it.
+const outputSchema = 3
+
+const schemaPrefix = "#schema:v"
+
+// schemaColumns are the columns added by the versions after the first,
+// each right after the column after
+var schemaColumns = []struct {
+	version     int
+	name, after string
+}{
+	{2, "UserType", "Likes"},
+	{3, "SuspectTS", "UserType"},
+}
+
+// writeSchemaLine writes the #schema:vN line, before the header
+func writeSchemaLine(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s%d\n", schemaPrefix, outputSchema)
+	return err
+}
+
+// readOutputSchema returns the schema version and the header of the
+// output file fName
+func readOutputSchema(fName string) (int, []string, error) {
+	file, err := os.Open(fName)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	br := bufio.NewReader(file)
+	version := 1
+	if first, err := br.Peek(len(schemaPrefix)); err == nil && string(first) == schemaPrefix {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return 0, nil, fmt.Errorf("cannot read the schema line: %s", err)
+		}
+		version, err = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, schemaPrefix)))
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid schema line %q", strings.TrimSpace(line))
+		}
+	}
+	reader := csv.NewReader(br)
+	reader.Comma = '\t'
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot read the header: %s", err)
+	}
+	return version, header, nil
+}
+
+// checkOutputSchema returns an error if rows with header may not be
+// appended to the output file fName: it was written by another schema
+// version or with other columns, e.g. without -filter-param all,suggested
+func checkOutputSchema(fName string, header []string) error {
+	version, existing, err := readOutputSchema(fName)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fName, err)
+	}
+	if version < outputSchema {
+		return withCode(exitUsage, "%s has output schema v%d, this version writes v%d: rerun with -upgrade-schema to rewrite it, keeping a backup, or move it aside",
+			fName, version, outputSchema)
+	}
+	if version != outputSchema {
+		return withCode(exitUsage, "%s has output schema v%d, this version writes v%d: move it aside or scrape into a new file", fName, version, outputSchema)
+	}
+	if strings.Join(existing, "\t") != strings.Join(header, "\t") {
+		return fmt.Errorf("%s has the columns %s, this run writes %s: use the same flags or scrape into a new file",
+			fName, strings.Join(existing, ","), strings.Join(header, ","))
+	}
+	return nil
+}
+
+// upgradeOutputSchema rewrites the output file fName if an older schema
+// version wrote it, adding the later columns so that rows with header
+// may be appended: UserType is left empty, the author's type being
+// unknown, and SuspectTS is told from CreatedAt and now. The columns
+// that do not depend on the version must already match header. The
+// original is copied to fName.vN.bak first and the file is replaced
+// atomically. Only -upgrade-schema runs it.
+func upgradeOutputSchema(fName string, header []string, quote string, quoteIDs bool, now time.Time) error {
+	version, existing, err := readOutputSchema(fName)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fName, err)
+	}
+	if version >= outputSchema {
+		return nil
+	}
+	// the columns added and where, in turn
+	upgraded := existing
+	var added []string
+	var at []int
+	for _, c := range schemaColumns {
+		if c.version > version {
+			i := columnIndex(upgraded, c.after) + 1
+			upgraded = insertCell(upgraded, i, c.name)
+			added, at = append(added, c.name), append(at, i)
+		}
+	}
+	if strings.Join(upgraded, "\t") != strings.Join(header, "\t") {
+		return fmt.Errorf("%s has output schema v%d with the columns %s, this run writes %s: use the same flags or scrape into a new file",
+			fName, version, strings.Join(existing, ","), strings.Join(header, ","))
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", fName, version)
+	if err := copyFile(fName, backup); err != nil {
+		return fmt.Errorf("cannot back up %s: %s", fName, err)
+	}
+	src, err := os.Open(fName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	reader := csv.NewReader(src)
+	reader.Comma = '\t'
+	reader.LazyQuotes = true
+	// skips the #schema line
+	reader.Comment = '#'
+	reader.FieldsPerRecord = len(existing)
+	if _, err := reader.Read(); err != nil {
+		return fmt.Errorf("%s: cannot read the header: %s", fName, err)
+	}
+	tmp := fName + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer dst.Close()
+	w := bufio.NewWriter(dst)
+	if err := writeSchemaLine(w); err != nil {
+		return err
+	}
+	writer := newRowWriter(w, quote, quoteIDs)
+	writer.Write(header)
+	created := columnIndex(existing, "CreatedAt")
+	rows := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", fName, err)
+		}
+		for n, name := range added {
+			value := ""
+			if name == "SuspectTS" {
+				t, err := time.Parse(time.RFC3339, row[created])
+				// a time that cannot be read cannot be trusted either
+				value = strconv.FormatBool(err != nil || suspectTime(t, now))
+			}
+			row = insertCell(row, at[n], value)
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+		rows++
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, fName); err != nil {
+		return err
+	}
+	logger.Printf("upgraded %s from output schema v%d to v%d, adding %s to %d rows, the original is in %s\n",
+		fName, version, outputSchema, strings.Join(added, " and "), rows, backup)
+	return nil
+}
+
+// copyFile copies src to dst, synced, replacing dst if it exists
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// columnIndex returns the index of the column name in header, -1 if none
+func columnIndex(header []string, name string) int {
+	for i, h := range header {
+		if h == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertCell returns row with value inserted at i
+func insertCell(row []string, i int, value string) []string {
+	out := make([]string, 0, len(row)+1)
+	out = append(out, row[:i]...)
+	out = append(out, value)
+	return append(out, row[i:]...)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var schemaNow = time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+func writeOutput(t *testing.T, content string) string {
+	name := filepath.Join(t.TempDir(), "AAPL.csv")
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestUpgradeOutputSchema(t *testing.T) {
+	quietLogger(t)
+	header := []string{"Id", "CreatedAt", "Body", "Sentiment", "Likes", "UserType", "SuspectTS", "SourceFilter"}
+	tests := []struct {
+		name, in, want string
+	}{
+		{"v1",
+			"Id\tCreatedAt\tBody\tSentiment\tLikes\tSourceFilter\n" +
+				"1020\t2024-05-01T10:00:00Z\t\"quoted \"\"buy\"\"\"\tBullish\t3\tall\n" +
+				"1019\t2024-07-01T10:00:00Z\tfrom the future\t\t0\tall,suggested\n" +
+				"1018\t2001-01-01T00:00:00Z\tbefore StockTwits\t\t0\tall\n" +
+				"1017\tyesterday\tunreadable time\t\t1\tall\n",
+			"#schema:v3\nId\tCreatedAt\tBody\tSentiment\tLikes\tUserType\tSuspectTS\tSourceFilter\n" +
+				"1020\t2024-05-01T10:00:00Z\t\"quoted \"\"buy\"\"\"\tBullish\t3\t\tfalse\tall\n" +
+				"1019\t2024-07-01T10:00:00Z\tfrom the future\t\t0\t\ttrue\tall,suggested\n" +
+				"1018\t2001-01-01T00:00:00Z\tbefore StockTwits\t\t0\t\ttrue\tall\n" +
+				"1017\tyesterday\tunreadable time\t\t1\t\ttrue\tall\n"},
+		{"v2",
+			"#schema:v2\nId\tCreatedAt\tBody\tSentiment\tLikes\tUserType\tSourceFilter\n" +
+				"1020\t2024-05-01T10:00:00Z\tbody\t\t3\tprofessional\tall\n",
+			"#schema:v3\nId\tCreatedAt\tBody\tSentiment\tLikes\tUserType\tSuspectTS\tSourceFilter\n" +
+				"1020\t2024-05-01T10:00:00Z\tbody\t\t3\tprofessional\tfalse\tall\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := writeOutput(t, tt.in)
+			if err := upgradeOutputSchema(name, header, "minimal", false, schemaNow); err != nil {
+				t.Fatal(err)
+			}
+			backup := name + ".v" + tt.name[1:] + ".bak"
+			if data, err := os.ReadFile(backup); err != nil || string(data) != tt.in {
+				t.Fatalf("backup %s = %q, %v, want the original", backup, data, err)
+			}
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("upgraded to\n%s\nwant\n%s", data, tt.want)
+			}
+			// the upgraded file is accepted and not upgraded again
+			if err := checkOutputSchema(name, header); err != nil {
+				t.Fatal(err)
+			}
+			if err := upgradeOutputSchema(name, header, "minimal", false, schemaNow); err != nil {
+				t.Fatal(err)
+			}
+			if again, _ := os.ReadFile(name); string(again) != tt.want {
+				t.Fatalf("upgraded twice to\n%s", again)
+			}
+		})
+	}
+}
+
+func TestUpgradeOutputSchemaRefusesOtherColumns(t *testing.T) {
+	quietLogger(t)
+	// written with -filter-param all,suggested, this run scrapes one filter
+	in := "Id\tCreatedAt\tBody\tSentiment\tLikes\tSourceFilter\n1020\t2024-05-01T10:00:00Z\tbody\t\t3\tall\n"
+	name := writeOutput(t, in)
+	header := []string{"Id", "CreatedAt", "Body", "Sentiment", "Likes", "UserType", "SuspectTS"}
+	err := upgradeOutputSchema(name, header, "minimal", false, schemaNow)
+	if err == nil || !strings.Contains(err.Error(), "v1") {
+		t.Fatalf("upgradeOutputSchema = %v, want an error naming v1", err)
+	}
+	if data, _ := os.ReadFile(name); string(data) != in {
+		t.Fatalf("the refused file was changed to\n%s", data)
+	}
+}
+
+func TestCheckOutputSchemaRefusesNewerVersion(t *testing.T) {
+	header := []string{"Id", "CreatedAt", "Body", "Sentiment", "Likes", "UserType", "SuspectTS"}
+	name := writeOutput(t, "#schema:v9\n"+strings.Join(header, "\t")+"\n")
+	if err := upgradeOutputSchema(name, header, "minimal", false, schemaNow); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOutputSchema(name, header); err == nil {
+		t.Fatal("checkOutputSchema accepted output schema v9")
+	}
+}
+
+func TestScrapeUpgradesSchemaOnlyWhenAsked(t *testing.T) {
+	quietLogger(t)
+	ts := httptest.NewServer(&benchServer{perPage: 5, pages: 2, start: time.Now().UTC()})
+	defer ts.Close()
+	cfg, err := defaultConfig(t).forFixture(t.TempDir(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "#schema:v2\nId\tCreatedAt\tBody\tSentiment\tLikes\tUserType\n1\t2024-05-01T10:00:00Z\tbody\t\t0\tretail\n"
+	name := cfg.outputPath(".csv")
+	if err := os.WriteFile(name, []byte(in), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = scrape(cfg)
+	if exitCode(err) != exitUsage || !strings.Contains(err.Error(), "-upgrade-schema") {
+		t.Fatalf("scrape = %v, want exit code %d pointing at -upgrade-schema", err, exitUsage)
+	}
+	if data, _ := os.ReadFile(name); string(data) != in {
+		t.Fatalf("the refused file was changed to\n%s", data)
+	}
+
+	cfg.upgradeSchema = true
+	if err := scrape(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(name + ".v2.bak"); err != nil || string(data) != in {
+		t.Fatalf("backup = %q, %v, want the original", data, err)
+	}
+	if data, _ := os.ReadFile(name); !strings.HasPrefix(string(data), "#schema:v3\n") || countRows(t, name) != 11 {
+		t.Fatalf("upgraded file has %d rows:\n%s", countRows(t, name), data)
+	}
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
-	"encoding/csv"
+	"bytes"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"log"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -39,6 +42,12 @@ func (t *Time) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON implements the json.Marshaler interface, in the format
+// UnmarshalJSON expects.
+func (t Time) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(t.Format("Mon, 02 Jan 2006 15:04:05 -0000"))), nil
+}
+
 // Message represents a message extracted from stocktwits.com
 type Message struct {
 	ID        int64  `json:"id"`
@@ -49,6 +58,27 @@ type Message struct {
 		Name  string `json:"name"`
 	} `json:"sentiment"`
 	TotalLikes int `json:"total_likes"`
+	// LikedByCurrentUser and ResharedByCurrentUser are only sent to a logged-in session
+	LikedByCurrentUser    bool `json:"liked_by_current_user"`
+	ResharedByCurrentUser bool `json:"reshared_by_current_user"`
+	Symbols               []struct {
+		Symbol string `json:"symbol"`
+	} `json:"symbols"`
+	User struct {
+		ID        int64  `json:"id"`
+		Username  string `json:"username"`
+		Followers int    `json:"followers"`
+		// UserType tells retail traders from professionals, where the API sends it
+		UserType string `json:"user_type"`
+	} `json:"user"`
+}
+
+// sentiment returns the sentiment name, Neutral if the author set none
+func (m *Message) sentiment() string {
+	if m.Sentiment.Name == "" {
+		return "Neutral"
+	}
+	return m.Sentiment.Name
 }
 
 // Stream is the response type of stocktwits
@@ -58,184 +88,1345 @@ type Stream struct {
 	Since    int64     `json:"since,omitempty"`
 	Max      int64     `json:"max,omitempty"`
 	Messages []Message `json:"messages"`
+	apiEnvelope
+}
+
+// apiEnvelope is how the API reports errors in the body, sometimes in a
+// 200 response: {"response":{"status":429}}, with or without
+// {"errors":[{"message":"Rate limit exceeded"}]}. Both are kept raw so
+// that a response shaped otherwise still decodes.
+type apiEnvelope struct {
+	Response json.RawMessage `json:"response,omitempty"`
+	Errors   json.RawMessage `json:"errors,omitempty"`
+}
+
+// apiError returns the error status and messages of the envelope, if it
+// reports an error. The status is 0 when only messages are given.
+func (e *apiEnvelope) apiError() (int, error) {
+	var response struct {
+		Status int `json:"status"`
+	}
+	json.Unmarshal(e.Response, &response)
+	status := 0
+	if response.Status >= 400 {
+		status = response.Status
+	}
+	var reasons []string
+	var errs []struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(e.Errors, &errs) == nil {
+		for _, reason := range errs {
+			reasons = append(reasons, reason.Message)
+		}
+	} else {
+		// a list of plain strings
+		json.Unmarshal(e.Errors, &reasons)
+	}
+	switch {
+	case status == 0 && len(reasons) == 0:
+		return 0, nil
+	case status == 0:
+		return 0, fmt.Errorf("API error: %s", strings.Join(reasons, "; "))
+	case len(reasons) == 0:
+		return status, fmt.Errorf("API error status %d", status)
+	}
+	return status, fmt.Errorf("API error status %d: %s", status, strings.Join(reasons, "; "))
+}
+
+// isStreamBody reports whether body, decoded into data, is an API
+// response: it has messages or at least says whether there are more. A
+// login or error page decodes to an empty Stream with neither.
+func isStreamBody(body []byte, data *Stream) bool {
+	if len(data.Messages) > 0 {
+		return true
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err == nil {
+		if _, ok := fields["more"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateStream fails a response that is not an API response, see isStreamBody
+func validateStream(isStream bool, data *Stream) error {
+	if isStream {
+		return nil
+	}
+	return fmt.Errorf("response validation failed: got empty Stream with More=%t, possible redirect", data.More)
+}
+
+// streamState is the progress of one filtered stream
+type streamState struct {
+	probe pageProbe
+	// stats flags batches unlike the recent ones
+	stats batchStats
+	// lowBatches counts consecutive batches under -min-messages-per-batch
+	lowBatches int
+	// prevMax is the max of the last poll, which the next one must go below
+	prevMax int64
+	// written is the max the stream goes on below when resumed and
+	// writtenStop its stopReason, both as of the last committed page, see
+	// commitProgress
+	written     int64
+	writtenStop string
+	// sinceID is the newest existing row, which the stream stops at
+	sinceID int64
+	// olderThanDate counts the messages older than -date in a row
+	olderThanDate dateRun
+	// stopReason tells why the stream ended, empty while it is running
+	stopReason string
+	// end finishes the stream in the scrape's lifecycle, once however often it is called
+	end func()
+	// retries is the retry budget of the stream's requests
+	retries *retryBudget
+}
+
+// retryBudget is the retries left and the backoff of one sequence of
+// requests, the symbol page or a filter's stream. Each has a single
+// request in flight, so its budget needs no lock, and one stream's
+// success does not refill another's budget.
+type retryBudget struct {
+	remain int
+	wait   *backoff
+}
+
+func newRetryBudget(cfg *config) *retryBudget {
+	return &retryBudget{remain: cfg.retry, wait: cfg.retryBackoff.clone()}
+}
+
+// reset refills the budget after a successful request
+func (b *retryBudget) reset(cfg *config) {
+	b.remain = cfg.retry
+	b.wait.Reset()
 }
 
 type scrapeInfos struct {
 	symbol    string
 	csrfToken string
 	id        int
-	delay     time.Duration
-	wg        sync.WaitGroup
-	mutex     sync.Mutex
+	delay     *backoff
+	// schedule scales delay by time of day if set
+	schedule *delaySchedule
+	// err is the first failure of the run, see fail
+	err      error
+	errMutex sync.Mutex
+	// csrfReady and idReady receive the outcome of extracting the CSRF
+	// token and the stream id from the symbol page, pageReceived that its
+	// response arrived, which starts -token-extraction-timeout
+	csrfReady    chan error
+	idReady      chan error
+	pageReceived chan struct{}
+	mutex        sync.Mutex
 }
 
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 6.1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2228.0 Safari/537.36"
+
 var (
 	logger *log.Logger
-	infos  *scrapeInfos
-	c      *colly.Collector
+	// reqLog receives the collector events if -request-log is set
+	reqLog *requestLog
+	// pause holds back new requests while toggled by the pause signal
+	pause = newPauser()
+	// diag samples requests with their block and rate limit headers if -diag is set
+	diag *diagLog
+	// fileMode is the permission of every file created, see -file-mode
+	fileMode os.FileMode = 0644
+	// openFiles holds the output files and journals of every symbol, see -max-open-files
+	openFiles = newFilePool(0)
 )
 
-// Send request to retrieve data
-func pollMessages(url string, csrfToken string) error {
-	infos.wg.Wait()
-	time.Sleep(infos.delay * time.Millisecond)
+// fail records err as the reason the run failed, unless one is recorded already
+func (i *scrapeInfos) fail(err error) {
+	i.errMutex.Lock()
+	defer i.errMutex.Unlock()
+	if i.err == nil {
+		i.err = err
+	}
+}
+
+// failed returns the recorded failure, if any
+func (i *scrapeInfos) failed() error {
+	i.errMutex.Lock()
+	defer i.errMutex.Unlock()
+	return i.err
+}
+
+// awaitBootstrap reports whether the CSRF token and the stream id were
+// extracted from the symbol page within timeout of its response. visited
+// is closed once the visit returns, having run every callback, so a value
+// not sent by then is missing, e.g. when the page is not HTML or a
+// selector matched nothing. The wait for the response itself is bounded by
+// -page-visit-timeout.
+func (i *scrapeInfos) awaitBootstrap(visited <-chan struct{}, timeout time.Duration) error {
+	select {
+	case <-i.pageReceived:
+	case <-visited:
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	csrf, id := i.csrfReady, i.idReady
+	for csrf != nil || id != nil {
+		var err error
+		select {
+		case err = <-csrf:
+			csrf = nil
+		case err = <-id:
+			id = nil
+		case <-visited:
+			if err := i.failed(); err != nil {
+				return err
+			}
+			// values sent before the visit returned are buffered
+			for _, ready := range []*chan error{&csrf, &id} {
+				if *ready == nil {
+					continue
+				}
+				select {
+				case err := <-*ready:
+					if err != nil {
+						return err
+					}
+					*ready = nil
+				default:
+				}
+			}
+			if csrf != nil || id != nil {
+				return missingBootstrap(csrf, id, "")
+			}
+			return nil
+		case <-deadline.C:
+			return missingBootstrap(csrf, id, fmt.Sprintf(" within %s, see -token-extraction-timeout", timeout))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return i.failed()
+}
+
+// missingBootstrap is the error for the extractions whose channel is still set
+func missingBootstrap(csrf, id chan error, within string) error {
+	var missing []string
+	if csrf != nil {
+		missing = append(missing, "csrf token")
+	}
+	if id != nil {
+		missing = append(missing, "stream id")
+	}
+	return withCode(exitSymbolNotFound, "%s not extracted from the symbol page%s", strings.Join(missing, " and "), within)
+}
+
+// signalReady sends the outcome of an extraction unless one was sent
+// already, as for a retried symbol page
+func signalReady(ready chan error, err error) {
+	select {
+	case ready <- err:
+	default:
+	}
+}
+
+// isSymbolPage reports whether the request of ctx is the symbol page
+// visit, stream polls carry their filter
+func isSymbolPage(ctx *colly.Context) bool {
+	return ctx.Get("filter") == ""
+}
+
+// Send request to retrieve data, filter is kept in the request context.
+// An error is returned only if the request was not sent, as when colly
+// refuses a URL visited already: the failures of a request sent go to
+// OnError, which retries or ends the stream.
+func pollMessages(c *colly.Collector, infos *scrapeInfos, url string, csrfToken string, filter string) error {
+	delay := infos.delay.Next()
+	if infos.schedule != nil {
+		delay = infos.schedule.scale(delay, time.Now())
+	}
+	time.Sleep(delay)
+	pause.wait()
 
 	hdr := http.Header{}
 	hdr.Set("x-csrf-token", csrfToken)
 	hdr.Set("x-requested-with", "XMLHttpRequest")
 	// logger.Printf("ready to send request: %s\n%v\n", url, hdr)
-	return c.Request("GET", url, nil, nil, hdr)
+	ctx := colly.NewContext()
+	ctx.Put("filter", filter)
+	err := c.Request("GET", url, nil, ctx, hdr)
+	if ctx.GetAny("sent") != nil {
+		return nil
+	}
+	return err
+}
+
+// userAgent composes the User-Agent, identifying us with contact info if given.
+// The contact is escaped so it cannot break out of the UA comment.
+func userAgent(contact string) string {
+	if contact == "" {
+		return defaultUserAgent
+	}
+	return fmt.Sprintf("%s (contact: %s; github.com/xg-wang/stockscraper)",
+		defaultUserAgent, url.PathEscape(contact))
 }
 
 func main() {
+	os.Exit(run())
+}
+
+// run does the work of main and returns the exit code
+func run() int {
+	cfg, err := parseConfig()
 	logger = log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile)
 	logger.SetPrefix("\n")
 	// logger := log.New(ioutil.Discard, "", log.Ldate|log.Ltime|log.Lshortfile)
+	if err != nil {
+		logger.Printf("invalid configuration:\n%s", err)
+		return exitUsage
+	}
+	fileMode = cfg.fileMode
+	openFiles = newFilePool(cfg.maxOpenFiles)
+	logOut, closeLog, err := cfg.openLogOutput()
+	if err != nil {
+		logger.Printf("Cannot open log file %q: %s\n", cfg.logFile, err)
+		return exitError
+	}
+	defer closeLog()
+	logger.SetOutput(logOut)
+	for _, w := range cfg.warnings {
+		logger.Printf("WARNING: %s\n", w)
+	}
+	logConfig()
+	logger.Printf("random seed is %d\n", cfg.seed)
+	handlePauseSignal(pause)
+	if cfg.validateOnly {
+		if !runStartupChecks(startupChecks(cfg), startupCheckTimeout, startupChecksTimeout) {
+			logger.Println("validation failed")
+			return exitError
+		}
+		logger.Println("configuration is valid")
+		return exitComplete
+	}
+	if cfg.requestLog != "" {
+		reqLog, err = openRequestLog(cfg.requestLog)
+		if err != nil {
+			logger.Printf("Cannot open request log %q: %s\n", cfg.requestLog, err)
+			return exitError
+		}
+		defer reqLog.Close()
+	}
+	if cfg.diag != "" {
+		diag, err = openDiagLog(cfg.diag, cfg.diagSample, rand.New(rand.NewSource(cfg.rand.Int63())))
+		if err != nil {
+			logger.Printf("Cannot open diagnostics %q: %s\n", cfg.diag, err)
+			return exitError
+		}
+		defer diag.Close()
+	}
+	if cfg.selftest {
+		if err := runSelftest(cfg); err != nil {
+			logger.Printf("selftest failed: %s\n", err)
+			return exitError
+		}
+		logger.Println("selftest passed")
+		return exitComplete
+	}
+	if cfg.bench {
+		if err := runBench(cfg); err != nil {
+			logger.Printf("ERROR: %s\n", err)
+			return exitCode(err)
+		}
+		return exitComplete
+	}
+	if cfg.convert != "" {
+		rows, err := runConvert(cfg.convert, cfg.convertOut)
+		if err != nil {
+			logger.Printf("ERROR: cannot convert: %s\n", err)
+			return exitError
+		}
+		logger.Printf("converted %d rows to %s\n", rows, cfg.convertOut)
+		return exitComplete
+	}
+	// every mode below sends requests to the site
+	if cfg.ackFile != "" {
+		if err := checkAcknowledgement(cfg.ackFile); err != nil {
+			logger.Printf("ERROR: %s\n", err)
+			return exitUsage
+		}
+	}
+	if cfg.importWatchlist != "" {
+		symbols, err := importWatchlist(cfg.importWatchlist, cfg.importFormat)
+		if err != nil {
+			logger.Println(err)
+			return exitError
+		}
+		if cfg.warnPennyStock && !checkPennyStocks(cfg, symbols) {
+			return exitUsage
+		}
+		if cfg.importDryRun {
+			fmt.Println(strings.Join(symbols, "\n"))
+			return exitComplete
+		}
+		targets := make([]resumeTarget, len(symbols))
+		for i, symbol := range symbols {
+			targets[i] = resumeTarget{symbol: symbol}
+		}
+		return scrapeTargets(cfg, cfg.outDir, targets)
+	}
+	if cfg.resumeAll == "" {
+		err := scrape(cfg)
+		if err != nil {
+			logger.Printf("ERROR: %s\n", err)
+		}
+		return exitCode(err)
+	}
+
+	targets, err := resumeTargets(cfg.resumeAll)
+	if err != nil {
+		logger.Println(err)
+		return exitError
+	}
+	if cfg.warnPennyStock {
+		symbols := make([]string, len(targets))
+		for i, t := range targets {
+			symbols[i] = t.symbol
+		}
+		if !checkPennyStocks(cfg, symbols) {
+			return exitUsage
+		}
+	}
+	return scrapeTargets(cfg, cfg.resumeAll, targets)
+}
+
+// scrapeTargets scrapes the targets into dir, from their latest ID if set,
+// with up to -symbol-concurrency of them at the same time. A symbol starts
+// -min-interval-between-symbols after the last one started or finished.
+func scrapeTargets(cfg *config, dir string, targets []resumeTarget) int {
+	var (
+		failed []error
+		mutex  sync.Mutex
+		wg     sync.WaitGroup
+		// last is when a symbol last started or finished
+		last time.Time
+	)
+	slots := make(chan struct{}, cfg.symbolConcurrency)
+	for _, t := range targets {
+		symCfg := *cfg
+		symCfg.symbol, symCfg.outDir, symCfg.sinceID = t.symbol, dir, t.latestID
+		// concurrent symbols must not share retry attempts
+		symCfg.retryBackoff = cfg.retryBackoff.clone()
+		select {
+		case slots <- struct{}{}:
+		default:
+			logger.Printf("%s is waiting for a free slot of -symbol-concurrency %d\n", t.symbol, cfg.symbolConcurrency)
+			slots <- struct{}{}
+		}
+		var gap time.Duration
+		if cfg.symbolInterval > 0 {
+			mutex.Lock()
+			if !last.IsZero() {
+				gap = cfg.symbolInterval - time.Since(last)
+			}
+			mutex.Unlock()
+			if gap > 0 {
+				time.Sleep(gap)
+			} else {
+				gap = 0
+			}
+			mutex.Lock()
+			last = time.Now()
+			mutex.Unlock()
+		}
+		started := fmt.Sprintf("scraping %s", t.symbol)
+		if t.latestID > 0 {
+			started = fmt.Sprintf("resuming %s from id %d", t.symbol, t.latestID)
+		}
+		if cfg.symbolInterval > 0 {
+			started += fmt.Sprintf(" after a gap of %s", gap.Round(time.Millisecond))
+		}
+		logger.Println(started)
+		wg.Add(1)
+		go func(symbol string) {
+			defer func() {
+				mutex.Lock()
+				last = time.Now()
+				mutex.Unlock()
+				<-slots
+				wg.Done()
+			}()
+			if err := scrape(&symCfg); err != nil {
+				logger.Printf("ERROR: %s: %s\n", symbol, err)
+				mutex.Lock()
+				failed = append(failed, err)
+				mutex.Unlock()
+			}
+		}(t.symbol)
+	}
+	wg.Wait()
+	if len(failed) == 0 {
+		return exitComplete
+	}
+	logger.Printf("%d of %d symbols failed\n", len(failed), len(targets))
+	if len(failed) < len(targets) {
+		return exitPartial
+	}
+	return exitCode(failed[0])
+}
 
-	var symbol = flag.String("symbol", "AAPL", "symbol to look for")
-	var maxDateStr = flag.String("date", "2014-11-11", "earliest date for data, default to 2014-11-11")
-	var maxID = flag.Int64("id", 0, "restart from maxID")
-	var delay = flag.Int64("delay", 500, "delay ms between request, default 500")
-	var retry = flag.Int("retry", 5, "retry request if failed, default 5, -1 for unlimited")
-	flag.Parse()
-	retryRemain := *retry
+// scrape runs the whole scrape of cfg.symbol into its output file
+func scrape(cfg *config) error {
+	meta := runMeta{Version: toolVersion(), Config: effectiveConfig(), StartedAt: time.Now(), AcknowledgedTerms: cfg.ackFile != ""}
+	timing := newStageTimings(timingEvery)
 
-	fName := fmt.Sprintf("%s.csv", *symbol)
-	maxDate, err := time.Parse("2006-01-02", *maxDateStr)
+	fName := cfg.outputPath(".csv")
+	jName := cfg.outputPath(".journal")
+	jrnl, err := openJournal(jName)
 	if err != nil {
-		logger.Fatal(err)
+		return fmt.Errorf("cannot open journal %q: %s", jName, err)
 	}
-	file, err := os.OpenFile(fName, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+	defer jrnl.Close()
+	// drop the rows of a page interrupted by a crash in the last run
+	if p, err := jrnl.pending(); err != nil {
+		return fmt.Errorf("cannot read journal %q: %s", jName, err)
+	} else if p != nil {
+		n, err := recoverOutput(fName, *p)
+		if err != nil {
+			return fmt.Errorf("cannot recover uncommitted page: %s", err)
+		}
+		logger.Printf("dropped %d rows of uncommitted page %d - %d\n", n, p.Since, p.Max)
+	}
+	if err := jrnl.reset(); err != nil {
+		return fmt.Errorf("cannot reset journal %q: %s", jName, err)
+	}
+
+	header := cfg.outputHeader()
+	// with -upgrade-schema, a file of an older schema is rewritten before
+	// it is opened to append, otherwise checkOutputSchema refuses it
+	if stat, err := os.Stat(fName); err == nil && stat.Size() >= 40 && cfg.upgradeSchema {
+		if err := upgradeOutputSchema(fName, header, cfg.quote, cfg.quoteIDs, time.Now()); err != nil {
+			return err
+		}
+	}
+	file, err := openFiles.openFile(fName, os.O_APPEND|os.O_CREATE|os.O_RDWR, fileMode)
 	if err != nil {
-		logger.Fatalf("Cannot open file %q: %s\n", fName, err)
-		return
+		return fmt.Errorf("cannot open file %q: %s", fName, err)
 	}
 	defer file.Close()
-	writer := csv.NewWriter(file)
-	writer.Comma = '\t'
+	writer := newRowWriter(file, cfg.quote, cfg.quoteIDs)
 	defer writer.Flush()
 
 	// Write CSV header
 	stat, err := file.Stat()
 	if err != nil {
-		logger.Fatal(err)
+		return err
 	}
 	// write head line if none
+	tagFilters := len(cfg.filters) > 1
+	interactions := cfg.authenticated()
 	if stat.Size() < 40 {
-		writer.Write([]string{"Id", "CreatedAt", "Body", "Sentiment", "Likes"})
+		if err := writeSchemaLine(file); err != nil {
+			return fmt.Errorf("cannot write %s: %s", fName, err)
+		}
+		if err := writer.Write(header); err != nil {
+			return fmt.Errorf("cannot write %s: %s", fName, err)
+		}
+	} else if err := checkOutputSchema(fName, header); err != nil {
+		return err
+	}
+	merger := newFilterMerger(cfg.filters, cfg.dedupMax)
+	var batches *batchLog
+	if cfg.batchMeta {
+		bName := cfg.outputPath(".batches.csv")
+		batches, err = openBatchLog(bName)
+		if err != nil {
+			return fmt.Errorf("cannot open file %q: %s", bName, err)
+		}
+		defer batches.Close()
+	}
+	var flips *flipTracker
+	if cfg.flips {
+		flips, err = openFlipTracker(cfg.outputPath(".flips.json"), cfg.outputPath(".flips.csv"))
+		if err != nil {
+			return fmt.Errorf("cannot open sentiment flips: %s", err)
+		}
+	}
+	var roster *rosterTracker
+	if cfg.roster {
+		roster, err = openRosterTracker(cfg.outputPath(".roster.json"), cfg.outputPath(".roster.csv"))
+		if err != nil {
+			return fmt.Errorf("cannot open author roster: %s", err)
+		}
+	}
+	var translations *translator
+	if len(cfg.translateCmd) > 0 {
+		translations, err = openTranslator(cfg.translateCmd, cfg.translateSkip, cfg.outputPath(".translations.jsonl"))
+		if err != nil {
+			// never fatal, the column stays empty
+			logger.Printf("WARNING: cannot open the translation cache, not translating: %s\n", err)
+			translations = nil
+		}
+	}
+	// per filter state, only touched by that filter's sequential responses
+	streams := map[string]*streamState{}
+	for _, filter := range cfg.filters {
+		streams[filter] = &streamState{retries: newRetryBudget(cfg), sinceID: cfg.sinceID}
+		// the max of an -initial-url is unknown
+		if cfg.initialURL == "" {
+			streams[filter].prevMax = cfg.maxID
+		}
+	}
+	pageRetries := newRetryBudget(cfg)
+	// retriesOf returns the budget of the request of ctx
+	retriesOf := func(ctx *colly.Context) *retryBudget {
+		if stream, ok := streams[ctx.Get("filter")]; ok {
+			return stream.retries
+		}
+		return pageRetries
+	}
+	// messages dropped by filters and rows written in this run
+	skipped, rows := 0, 0
+	// lowFollowers counts the skipped messages by -min-followers,
+	// otherUserType those by -filter-user-type
+	lowFollowers, otherUserType := 0, 0
+	// oldest and newest are the creation times of the rows written,
+	// failedRequests counts the requests that failed, retried or not
+	var oldest, newest time.Time
+	failedRequests := 0
+	guard := newResourceGuard(filepath.Dir(fName), cfg.minFreeDisk, cfg.maxMemory)
+	guard.files = []*pooledFile{file, jrnl.f}
+
+	// every filtered stream is begun before the first one can end
+	lifecycle := newScrapeLifecycle()
+	for _, stream := range streams {
+		lifecycle.Begin()
+		stream.end = sync.OnceFunc(lifecycle.Finish)
+	}
+	var cp *checkpoint
+	cpName := cfg.outputPath(".checkpoint.json")
+	if cfg.checkpointInterval > 0 {
+		cp = &checkpoint{Symbol: cfg.symbol, StartedAt: meta.StartedAt}
+		// -id or -initial-url ask for a start of their own
+		if cfg.maxID == 0 && cfg.initialURL == "" {
+			if prev, err := readCheckpoint(cpName); err != nil {
+				logger.Printf("WARNING: cannot read checkpoint %q, not resuming: %s\n", cpName, err)
+			} else if prev != nil && prev.Symbol == cfg.symbol {
+				latest, err := latestID(fName)
+				if err != nil {
+					return fmt.Errorf("cannot read %s: %s", fName, err)
+				}
+				if prev.resume(streams, latest) {
+					logger.Printf("resuming the run interrupted at %s from %s\n", prev.UpdatedAt.Format(time.RFC3339), cpName)
+				}
+			}
+		}
+	}
+	for _, stream := range streams {
+		stream.written = stream.prevMax
+	}
+	// saveCheckpoint records the progress so far, called with infos.mutex held
+	saveCheckpoint := func() {
+		cp.Rows = rows
+		cp.Written, cp.Stopped, cp.SinceID = map[string]int64{}, map[string]string{}, map[string]int64{}
+		for filter, stream := range streams {
+			cp.Written[filter] = stream.written
+			if stream.sinceID > 0 {
+				cp.SinceID[filter] = stream.sinceID
+			}
+			if stream.writtenStop != "" {
+				cp.Stopped[filter] = stream.writtenStop
+			}
+		}
+		if err := writeCheckpoint(cpName, cp); err != nil {
+			logger.Printf("WARNING: cannot write checkpoint %q: %s\n", cpName, err)
+		}
 	}
 
-	done := sync.WaitGroup{}
-	done.Add(1)
+	// commitProgress moves where each stream is resumed from past the
+	// messages released so far, called with infos.mutex held once they are
+	// written. A stream is only recorded as stopped once the merger holds
+	// none of its messages.
+	commitProgress := func() {
+		for filter, stream := range streams {
+			if max, ok := merger.resumeFrom(filter); ok {
+				stream.written = max
+			} else if merger.finished(filter) {
+				stream.writtenStop = stream.stopReason
+			}
+		}
+	}
 
 	// Instantiate default collector
-	c = colly.NewCollector()
-	c.SetDebugger(&debug.LogDebugger{})
+	c := colly.NewCollector()
+	if reqLog != nil {
+		reqLog.attach(c)
+	} else if cfg.logFile != "-" {
+		c.SetDebugger(&debug.LogDebugger{Output: logger.Writer()})
+	} else {
+		c.SetDebugger(&debug.LogDebugger{})
+	}
+	if diag != nil {
+		diag.attach(c)
+	}
+	if cfg.debugDumpDir != "" {
+		dump, err := newResponseDump(cfg.debugDumpDir, cfg.symbol)
+		if err != nil {
+			return fmt.Errorf("cannot create -debug-dump-dir %q: %s", cfg.debugDumpDir, err)
+		}
+		defer dump.Close()
+		dump.attach(c)
+	}
 	c.Limit(&colly.LimitRule{
 		DomainGlob:  "*stocktwits.com/streams",
 		Parallelism: 2,
 		Delay:       2 * time.Second,
 	})
-	c.UserAgent = "Mozilla/5.0 (Windows NT 6.1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2228.0 Safari/537.36"
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return err
+	}
+	c.WithTransport(transport)
+	// the transport times each request
+	c.SetRequestTimeout(0)
+	c.UserAgent = userAgent(cfg.uaContact)
+	if cfg.uaContact != "" {
+		logger.Printf("User-Agent is %q\n", c.UserAgent)
+	}
 
 	// Extract infos for request
-	infos = &scrapeInfos{symbol: *symbol, delay: time.Duration(*delay)}
-	infos.wg.Add(2)
-	c.OnHTML("meta[name=csrf-token]", func(e *colly.HTMLElement) {
-		defer infos.wg.Done()
-		infos.csrfToken = e.Attr("content")
-		if infos.csrfToken == "" {
-			logger.Fatalf("csrf token not found")
+	infos := &scrapeInfos{
+		symbol: stocktwitsSymbol(cfg.symbol),
+		// a constant delay between polls
+		delay:    &backoff{Base: cfg.delay, Max: cfg.delay, Factor: 1},
+		schedule: cfg.delaySchedule,
+
+		csrfReady:    make(chan error, 1),
+		idReady:      make(chan error, 1),
+		pageReceived: make(chan struct{}, 1),
+	}
+	if infos.symbol != cfg.symbol {
+		logger.Printf("%s is %s on StockTwits\n", cfg.symbol, infos.symbol)
+	}
+	if cfg.conversation == 0 {
+		c.OnHTML("link[rel=canonical]", func(e *colly.HTMLElement) {
+			if !isSymbolPage(e.Request.Ctx) {
+				return
+			}
+			// a redirect or a lenient lookup may land on another symbol
+			if symbol, ok := canonicalSymbol(e.Attr("href")); ok && !strings.EqualFold(symbol, infos.symbol) {
+				logger.Printf("WARNING: asked for %s but the symbol page is for %s\n", infos.symbol, symbol)
+			}
+		})
+	}
+	// a login or challenge page served to a stream poll is HTML too, only
+	// the symbol page is parsed
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		if !isSymbolPage(e.Request.Ctx) {
+			return
 		}
-		logger.Printf("csrfToken is %s\n", infos.csrfToken)
-	})
-	c.OnHTML("ol.stream-list", func(e *colly.HTMLElement) {
-		defer infos.wg.Done()
-		infos.id, err = strconv.Atoi(e.Attr("stream-id"))
+		token, err := cfg.selectors.parseCSRFToken(e)
 		if err != nil {
-			logger.Fatalf("id not found")
+			signalReady(infos.csrfReady, &codedError{code: exitSymbolNotFound, err: err})
+			return
 		}
-		logger.Printf("id is %d\n", infos.id)
+		infos.csrfToken = token
+		logger.Printf("csrfToken is %s\n", infos.csrfToken)
+		signalReady(infos.csrfReady, nil)
 	})
+	if cfg.conversation != 0 {
+		// a conversation's stream id is its root message's ID
+		infos.id = int(cfg.conversation)
+		infos.idReady <- nil
+	} else {
+		c.OnHTML("html", func(e *colly.HTMLElement) {
+			if !isSymbolPage(e.Request.Ctx) {
+				return
+			}
+			id, err := cfg.selectors.parseStreamID(e)
+			if err != nil {
+				signalReady(infos.idReady, &codedError{code: exitSymbolNotFound, err: err})
+				return
+			}
+			infos.id = id
+			logger.Printf("id is %d\n", infos.id)
+			signalReady(infos.idReady, nil)
+		})
+	}
 
-	go func() {
-		infos.wg.Wait()
-		url := fmt.Sprintf("https://stocktwits.com/streams/stream?stream=symbol&stream_id=%d&substream=all&username=undefined&symbol=undefined", infos.id)
-		if *maxID != 0 {
-			url = fmt.Sprintf("https://stocktwits.com/streams/poll?stream=symbol&stream_id=%d&substream=all&max=%d", infos.id, *maxID)
+	c.OnRequest(func(r *colly.Request) {
+		// the symbol page has no filter
+		if r.Ctx.Get("filter") == "" {
+			r.Headers.Set("Accept", cfg.accept)
+			transport.markPage(r.URL)
+		} else {
+			r.Headers.Set("Accept", cfg.pollAccept)
 		}
-		err := pollMessages(url, infos.csrfToken)
-		if err != nil {
-			logger.Println(err)
+		r.Headers.Set("Accept-Language", cfg.acceptLanguage)
+		if cfg.acceptEncoding != "" {
+			r.Headers.Set("Accept-Encoding", cfg.acceptEncoding)
 		}
-	}()
-
-	c.OnRequest(func(r *colly.Request) {
-		logger.Printf("URL    : %s\n", r.URL)
+		for name := range cfg.headers {
+			r.Headers.Set(name, cfg.headers.Get(name))
+		}
+		if cfg.requestIDHeader != "" {
+			// a new ID for every attempt, retries share the context
+			id := newRequestID()
+			r.Headers.Set(cfg.requestIDHeader, id)
+			r.Ctx.Put("requestID", id)
+		}
+		logger.Printf("URL    : %s%s\n", r.URL, requestIDSuffix(r.Ctx))
+		r.Ctx.Put("sent", time.Now())
 		// logger.Printf("Headers: %v\n", r.Headers)
 	})
 
+	var cache *pageCache
+	if cfg.cacheDir != "" {
+		cache = newPageCache(cfg.cacheDir, cfg.cacheTTL, cfg.symbolPageURL(infos.symbol))
+	}
+
+	// retryOrFail retries a failed request or gives up after -retry attempts
+	retryOrFail := func(res *colly.Response, err error) {
+		infos.mutex.Lock()
+		failedRequests++
+		infos.mutex.Unlock()
+		if cache != nil && res.StatusCode == http.StatusForbidden {
+			cache.invalidate()
+		}
+		retries := retriesOf(res.Ctx)
+		if retries.remain == 0 {
+			code := exitError
+			if res.StatusCode == http.StatusTooManyRequests {
+				code = exitRateLimited
+			} else if res.StatusCode == http.StatusNotFound && res.Ctx.Get("filter") == "" {
+				code = exitSymbolNotFound
+			}
+			infos.fail(withCode(code, "giving up on %s%s: %s", res.Request.URL, requestIDSuffix(res.Ctx), err))
+			filter := res.Ctx.Get("filter")
+			if filter == "" {
+				// the symbol page, awaitBootstrap returns the failure
+				return
+			}
+			infos.mutex.Lock()
+			streams[filter].stopReason = "request failed"
+			infos.mutex.Unlock()
+			streams[filter].end()
+			return
+		}
+		retries.remain--
+		if cfg.torControl != nil && (res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusTooManyRequests) {
+			if rotated, err := cfg.torControl.rotate(); err != nil {
+				logger.Printf("WARNING: cannot switch Tor circuit: %s\n", err)
+			} else if rotated {
+				logger.Printf("switched Tor circuit after status %d\n", res.StatusCode)
+			}
+		}
+		wait := retries.wait.Next()
+		logger.Printf("ERROR: %s%s, retrying in %s...%d", err, requestIDSuffix(res.Ctx), wait, cfg.retry-retries.remain)
+		time.Sleep(wait)
+		res.Request.Retry()
+	}
+
+	// poll requests the page of filter at url, ending the stream if it
+	// cannot be sent, as nothing else would
+	poll := func(filter, url string) {
+		err := pollMessages(c, infos, url, infos.csrfToken, filter)
+		if err == nil {
+			return
+		}
+		infos.fail(fmt.Errorf("cannot request %s: %s", url, err))
+		infos.mutex.Lock()
+		streams[filter].stopReason = "request failed"
+		infos.mutex.Unlock()
+		streams[filter].end()
+	}
+
 	c.OnResponse(func(r *colly.Response) {
-		// reset retry once succeed
-		retryRemain = *retry
 		// logger.Printf("Response Headers: %v\n", r.Headers)
+		filter := r.Ctx.Get("filter")
+		if isSymbolPage(r.Ctx) {
+			select {
+			case infos.pageReceived <- struct{}{}:
+			default:
+			}
+		}
 		if strings.Index(r.Headers.Get("Content-Type"), "json") == -1 {
+			if cfg.validateResponse && filter != "" {
+				retryOrFail(r, fmt.Errorf("response validation failed: got Content-Type %q, possible redirect", r.Headers.Get("Content-Type")))
+				return
+			}
+			// reset retry once succeed
+			retriesOf(r.Ctx).reset(cfg)
+			return
+		}
+		scrapedAt := time.Now()
+		stream, ok := streams[filter]
+		if !ok {
+			// JSON served for the symbol page, awaitBootstrap reports it
 			return
 		}
+		parse := timing.begin(stageParse)
 		data := Stream{}
-		err := json.Unmarshal(r.Body, &data)
+		// messages at or below sinceID end the stream, with -stream-decode they are not decoded
+		caughtUp, isStream := false, false
+		var err error
+		if cfg.streamDecode {
+			isStream, err = decodeStream(bytes.NewReader(r.Body), &data, func(msg *Message) bool {
+				caughtUp = caughtUp || stream.sinceID > 0 && msg.ID <= stream.sinceID
+				return !caughtUp
+			})
+		} else if err = json.Unmarshal(r.Body, &data); err == nil {
+			isStream = isStreamBody(r.Body, &data)
+		}
 		if err != nil {
-			logger.Fatal(err)
+			infos.fail(fmt.Errorf("cannot decode the response to %s%s: %s", r.Request.URL, requestIDSuffix(r.Ctx), err))
+			infos.mutex.Lock()
+			stream.stopReason = "stopped after an error"
+			infos.mutex.Unlock()
+			stream.end()
+			return
+		}
+		if status, err := data.apiError(); err != nil {
+			// an error in a 200 response, retried as the status it carries
+			if status != 0 {
+				r.StatusCode = status
+			}
+			retryOrFail(r, err)
+			return
+		}
+		if cfg.validateResponse {
+			if err := validateStream(isStream, &data); err != nil {
+				retryOrFail(r, err)
+				return
+			}
+		}
+		// reset retry once succeed
+		stream.retries.reset(cfg)
+		if sent, ok := r.Ctx.GetAny("sent").(time.Time); ok {
+			timing.span(stageFetch, sent, scrapedAt, len(data.Messages))
+		}
+		parse.end(len(data.Messages))
+		// the stream's state is read by the checkpoint ticker
+		infos.mutex.Lock()
+		defer infos.mutex.Unlock()
+		// end condition
+		if stream.sinceID > 0 {
+			for i, msg := range data.Messages {
+				if msg.ID <= stream.sinceID {
+					data.Messages, caughtUp = data.Messages[:i], true
+					break
+				}
+			}
+		}
+		reachedDate, suspect := stream.olderThanDate.observe(data.Messages, cfg.maxDate, scrapedAt, cfg.dateConsecutive)
+		for _, msg := range suspect {
+			logger.Printf("WARNING: message %d for filter %s has a suspect CreatedAt %s, not counted towards -date\n",
+				msg.ID, filter, msg.CreatedAt.Format(time.RFC3339))
+		}
+		switch {
+		case infos.failed() != nil:
+			stream.stopReason = "stopped after an error"
+		case caughtUp:
+			stream.stopReason = "caught up with existing rows"
+		case len(data.Messages) == 0:
+			stream.stopReason = "no more messages"
+		case reachedDate:
+			stream.stopReason = "reached -date"
+		case cfg.exitOnMoreFalse && !data.More:
+			stream.stopReason = "more is false"
+		}
+		end := stream.stopReason != ""
+		if cfg.minBatch > 0 && !end {
+			if len(data.Messages) < cfg.minBatch {
+				stream.lowBatches++
+			} else {
+				stream.lowBatches = 0
+			}
+			if stream.lowBatches >= cfg.minBatchConsecutive {
+				logger.Printf("%d consecutive batches under %d messages for filter %s, stopping early\n",
+					stream.lowBatches, cfg.minBatch, filter)
+				stream.stopReason = "small batches"
+				end = true
+			}
 		}
 		if len(data.Messages) == 0 {
-			logger.Println("receiving 0 messages, exit...")
-			defer done.Done()
+			logger.Printf("receiving 0 messages for filter %s, exit...\n", filter)
+		} else {
+			if data.Since == 0 || data.Max == 0 {
+				data.Since = data.Messages[0].ID
+				data.Max = data.Messages[len(data.Messages)-1].ID
+			}
+			logger.Printf("Response got %d messages for filter %s, %d - %d\n", len(data.Messages), filter, data.Since, data.Max)
+			if cfg.maxIDGap > 0 {
+				for _, gap := range detectGaps(data.Messages) {
+					if gap.Size() > cfg.maxIDGap {
+						logger.Printf("WARNING: %d IDs missing between %d and %d\n", gap.Size(), gap.From, gap.To)
+					}
+				}
+			}
+		}
+		if !end && len(data.Messages) > 0 {
+			if stream.prevMax != 0 && data.Max >= stream.prevMax {
+				logger.Printf("WARNING: next max %d for filter %s is not below the previous %d, the pagination would loop\n",
+					data.Max, filter, stream.prevMax)
+				stream.stopReason = "pagination loop"
+				end = true
+			}
+			stream.prevMax = data.Max
+		}
+		if end {
+			logger.Printf("filter %s stopped: %s\n", filter, stream.stopReason)
+		}
+		if !end {
+			go poll(filter, cfg.buildStreamURL(infos.symbol, infos.id, data.Max, filter))
+		}
+		// ended even if the page fails below, the lifecycle would wait forever
+		if end {
+			defer stream.end()
+		}
+		if probe := &stream.probe; cfg.probePages > 0 && probe.pages < cfg.probePages {
+			probe.observe(data.Messages)
+			if probe.pages == cfg.probePages && !end {
+				if n, ok := probe.remaining(cfg.maxDate); ok {
+					logger.Printf("WARNING: after %d pages filter %s is at %s, -date %s may be very old, about %d more pages\n",
+						probe.pages, filter, probe.oldest.Format(time.RFC3339), cfg.maxDate.Format("2006-01-02"), n)
+				}
+			}
+		}
+		for _, anomaly := range stream.stats.observe(data.Messages, len(r.Body), end) {
+			logger.Printf("WARNING: ANOMALOUS BATCH for filter %s at max %d: %s, the API response shape may have changed\n",
+				filter, data.Max, anomaly)
+		}
+		if batches != nil {
+			if err := batches.record(scrapedAt, r.Headers.Get("Date"), filter, &data); err != nil {
+				infos.fail(fmt.Errorf("cannot record the batch in %s: %s", cfg.outputPath(".batches.csv"), err))
+				return
+			}
+		}
+		filtering := timing.begin(stageFilter)
+		released := merger.add(filter, data.Messages)
+		if end {
+			released = append(released, merger.finish(filter)...)
+		}
+		msgs := released[:0]
+		for _, msg := range released {
+			if !cfg.symbolFilter.keep(&msg.Message) {
+				continue
+			}
+			if msg.User.Followers < cfg.minFollowers {
+				lowFollowers++
+				continue
+			}
+			if cfg.userType != "" && !strings.EqualFold(msg.User.UserType, cfg.userType) {
+				otherUserType++
+				continue
+			}
+			if cfg.filterExpr != nil {
+				if ok, err := cfg.filterExpr.match(&msg.Message); err != nil {
+					logger.Printf("WARNING: %s, skipping it\n", err)
+					continue
+				} else if !ok {
+					continue
+				}
+			}
+			if cfg.anonymizer != nil {
+				cfg.anonymizer.message(&msg.Message)
+			}
+			if flips != nil {
+				flips.observe(&msg.Message)
+			}
+			if roster != nil {
+				roster.observe(&msg.Message)
+			}
+			msgs = append(msgs, msg)
+		}
+		if n := len(released) - len(msgs); n > 0 {
+			skipped += n
+			logger.Printf("skipped %d messages by filters\n", n)
+		}
+		switch cfg.sortOrder {
+		case "asc":
+			sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
+		case "desc":
+			sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID > msgs[j].ID })
+		}
+		filtering.end(len(released))
+		if infos.failed() != nil {
 			return
 		}
-		if data.Since == 0 || data.Max == 0 {
-			data.Since = data.Messages[0].ID
-			data.Max = data.Messages[len(data.Messages)-1].ID
+		if len(msgs) == 0 {
+			commitProgress()
+			if cp != nil {
+				saveCheckpoint()
+			}
+			return
 		}
-		logger.Printf("Response got %d messages, %d - %d\n", len(data.Messages), data.Since, data.Max)
-		go func() {
-			url := fmt.Sprintf("https://stocktwits.com/streams/poll?stream=symbol&stream_id=%d&substream=all&max=%d", infos.id, data.Max)
-			err := pollMessages(url, infos.csrfToken)
-			if err != nil {
-				logger.Println(err)
+		var translated []string
+		if translations != nil {
+			translated = translations.translate(msgs)
+		}
+		guard.waitForDisk()
+		writing := timing.begin(stageWrite)
+		// journal the page so a crash while writing it can be undone
+		writer.Flush()
+		stat, err := file.Stat()
+		if err != nil {
+			infos.fail(err)
+			return
+		}
+		since, max := msgs[0].ID, msgs[0].ID
+		for _, msg := range msgs {
+			if msg.ID > since {
+				since = msg.ID
 			}
-		}()
-		infos.mutex.Lock()
-		done.Add(1)
-		for _, msg := range data.Messages {
-			sentiment := "Neutral"
-			if msg.Sentiment.Name != "" {
-				sentiment = msg.Sentiment.Name
+			if msg.ID < max {
+				max = msg.ID
 			}
+		}
+		if err := jrnl.begin(since, max, stat.Size()); err != nil {
+			infos.fail(fmt.Errorf("cannot journal page %d - %d: %s", since, max, err))
+			return
+		}
+		var writeErr error
+		for i, msg := range msgs {
+			sentiment := msg.sentiment()
 			msg.Body = strings.Replace(msg.Body, "\n", "\\n", -1)
 			msg.Body = strings.Replace(msg.Body, "\t", " ", -1)
-			writer.Write(
-				[]string{
-					strconv.FormatInt(msg.ID, 10), msg.CreatedAt.Format(time.RFC3339), msg.Body,
-					sentiment, strconv.Itoa(msg.TotalLikes)})
+			row := []string{
+				strconv.FormatInt(msg.ID, 10), msg.CreatedAt.In(cfg.outputTZ).Format(time.RFC3339), msg.Body,
+				sentiment, strconv.Itoa(msg.TotalLikes), msg.User.UserType,
+				strconv.FormatBool(suspectTime(msg.CreatedAt.Time, scrapedAt))}
+			if tagFilters {
+				row = append(row, strings.Join(msg.filters, ","))
+			}
+			if interactions {
+				row = append(row, strconv.FormatBool(msg.LikedByCurrentUser), strconv.FormatBool(msg.ResharedByCurrentUser))
+			}
+			if len(cfg.translateCmd) > 0 {
+				text := ""
+				if translated != nil {
+					text = strings.Replace(strings.Replace(translated[i], "\n", "\\n", -1), "\t", " ", -1)
+				}
+				row = append(row, text)
+			}
+			if writeErr = writer.Write(row); writeErr != nil {
+				break
+			}
+			rows++
+			if oldest.IsZero() || msg.CreatedAt.Before(oldest) {
+				oldest = msg.CreatedAt.Time
+			}
+			if msg.CreatedAt.After(newest) {
+				newest = msg.CreatedAt.Time
+			}
 		}
-		done.Done()
-		infos.mutex.Unlock()
-		// end condition
-		if data.Messages[len(data.Messages)-1].CreatedAt.Before(maxDate) {
-			done.Done()
+		if writeErr == nil {
+			writer.Flush()
+			writeErr = writer.Error()
+		}
+		if writeErr == nil {
+			writeErr = file.Sync()
 		}
+		if writeErr != nil {
+			// the page stays uncommitted, the next run truncates it
+			infos.fail(fmt.Errorf("cannot write %s: %s", fName, writeErr))
+			return
+		}
+		if err := jrnl.commit(since, max, stat.Size()); err != nil {
+			// the rows are synced, the next run drops them as uncommitted
+			infos.fail(fmt.Errorf("cannot commit page %d - %d to the journal: %s", since, max, err))
+			return
+		}
+		commitProgress()
+		if cp != nil {
+			saveCheckpoint()
+		}
+		writing.end(len(msgs))
+		guard.checkMemory(writer.Flush)
 	})
 
-	c.OnError(func(res *colly.Response, err error) {
-		if retryRemain == 0 {
-			logger.Fatal("exit due to request failure.")
+	c.OnError(retryOrFail)
+
+	var ticker *checkpointTicker
+	if cp != nil {
+		// between pages, a slow page or a pause would leave the checkpoint stale
+		ticker = startCheckpointTicker(cfg.checkpointInterval, func() {
+			infos.mutex.Lock()
+			defer infos.mutex.Unlock()
+			writer.Flush()
+			if err := file.Sync(); err != nil {
+				logger.Printf("WARNING: cannot sync %s: %s\n", fName, err)
+			}
+			saveCheckpoint()
+			if roster != nil {
+				if err := roster.save(); err != nil {
+					logger.Printf("WARNING: cannot save author roster: %s\n", err)
+				}
+			}
+		})
+	}
+
+	// the visit returns once the page and its callbacks are done, it runs
+	// aside so that -token-extraction-timeout fails a parse that hangs
+	visited := make(chan struct{})
+	go func() {
+		defer close(visited)
+		if cache != nil {
+			cache.visit(c)
+		} else {
+			c.Visit(cfg.symbolPageURL(infos.symbol))
 		}
-		retryRemain--
-		logger.Print("ERROR: retrying..." + strconv.Itoa(*retry-retryRemain))
-		res.Request.Retry()
-	})
+	}()
+	if err := infos.awaitBootstrap(visited, cfg.tokenExtractionTimeout); err != nil {
+		infos.fail(err)
+	} else {
+		<-visited
+	}
+	for _, filter := range cfg.filters {
+		// -id, or where a resumed stream stopped
+		max := streams[filter].prevMax
+		go func(filter string) {
+			if infos.failed() != nil {
+				streams[filter].end()
+				return
+			}
+			url := cfg.initialURL
+			if url == "" {
+				url = cfg.buildStreamURL(infos.symbol, infos.id, max, filter)
+			}
+			poll(filter, url)
+		}(filter)
+	}
+
+	lifecycle.Wait()
+	if ticker != nil {
+		ticker.stop()
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		infos.fail(fmt.Errorf("cannot write %s: %s", fName, err))
+	}
+	meta.EndedAt = time.Now()
+	meta.Rows = rows
+	meta.Stages = timing.totals()
+	var reasons []string
+	for _, filter := range cfg.filters {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", filter, streams[filter].stopReason))
+	}
+	meta.StopReason = strings.Join(reasons, ", ")
+	err = infos.failed()
+	if err != nil {
+		meta.StopReason = err.Error()
+	}
+	if cp != nil {
+		saveCheckpoint()
+	}
+	mName := cfg.outputPath(".meta.json")
+	if err := writeRunMeta(mName, cfg.symbol, meta); err != nil {
+		logger.Printf("Cannot write run metadata %q: %s\n", mName, err)
+	}
+	if cfg.gapTolerance > 0 && err == nil {
+		gaps, created, err := outputGaps(fName, cfg.gapTolerance)
+		if err != nil {
+			logger.Printf("Cannot check %q for gaps: %s\n", fName, err)
+		}
+		for _, gap := range gaps {
+			logger.Printf("WARNING: %d IDs missing in %s between %d (%s) and %d (%s)\n", gap.Size(), fName,
+				gap.From, created[gap.From].Format(time.RFC3339), gap.To, created[gap.To].Format(time.RFC3339))
+		}
+		if err == nil {
+			logger.Printf("%d gaps over -resume-gap-tolerance %d in %s\n", len(gaps), cfg.gapTolerance, fName)
+		}
+	}
+	if cfg.validate && err == nil {
+		report, verr := validateOutput(fName, cfg.outputHeader())
+		if verr != nil {
+			err = fmt.Errorf("cannot validate %s: %s", fName, verr)
+		} else {
+			report.log(fName)
+			if report.structuralCount > 0 {
+				err = withCode(exitInvalidOutput, "%s failed validation with %d structural problems", fName, report.structuralCount)
+			}
+		}
+	}
+	if cfg.aggregate != "" && err == nil {
+		aggName := cfg.outputPath("." + cfg.aggregate + ".csv")
+		if err := aggregateOutput(fName, aggName, cfg.aggregate, cfg.outputTZ); err != nil {
+			logger.Printf("Cannot write aggregated counts %q: %s\n", aggName, err)
+		}
+	}
+	if flips != nil {
+		if err := flips.Close(); err != nil {
+			logger.Printf("Cannot save sentiment flips: %s\n", err)
+		}
+		logger.Printf("%d sentiment flips recorded in %s\n", flips.flips, cfg.outputPath(".flips.csv"))
+	}
+	if roster != nil {
+		if err := roster.Close(); err != nil {
+			logger.Printf("Cannot save author roster: %s\n", err)
+		}
+		logger.Printf("%d authors in %s\n", len(roster.state.Authors), cfg.outputPath(".roster.csv"))
+	}
+	if translations != nil {
+		if err := translations.Close(); err != nil {
+			logger.Printf("Cannot save translations: %s\n", err)
+		}
+		logger.Printf("translations: %d new, %d cached, %d failed\n", translations.translated, translations.cached, translations.failed)
+	}
+	if cfg.timing {
+		wall := meta.EndedAt.Sub(meta.StartedAt)
+		logger.Printf("time per stage over %s wall:\n", wall.Round(time.Millisecond))
+		for _, line := range timing.summary(wall) {
+			logger.Printf("  %s\n", line)
+		}
+	}
+	logger.Printf("skipped %d messages in total\n", skipped)
+	if cfg.minFollowers > 0 {
+		logger.Printf("%d of them by authors under %d followers\n", lowFollowers, cfg.minFollowers)
+	}
+	if cfg.userType != "" {
+		logger.Printf("%d of them by authors not of user type %s\n", otherUserType, cfg.userType)
+	}
+	logger.Printf("resource guards: %s\n", guard.summary())
+	if cfg.torControl != nil {
+		logger.Printf("Tor circuit switches: %d\n", cfg.torControl.rotations)
+	}
+	if merger.forced > 0 {
+		logger.Printf("%d messages were released early by -dedup-max, their SourceFilter may be incomplete\n", merger.forced)
+	}
+	if err == nil {
+		for _, filter := range cfg.filters {
+			if reason := streams[filter].stopReason; reason == "small batches" || reason == "pagination loop" {
+				err = withCode(exitPartial, "filter %s stopped early after %s", filter, reason)
+			}
+		}
+	}
+	if cfg.compactSummary {
+		logger.Printf("DONE symbol=%s written=%d oldest=%s newest=%s errors=%d dur=%s\n", cfg.symbol, rows,
+			summaryDate(oldest), summaryDate(newest), failedRequests, time.Since(meta.StartedAt).Round(time.Second))
+	}
+	return err
+}
 
-	c.Visit(fmt.Sprintf("https://stocktwits.com/symbol/%s", infos.symbol))
+// outputHeader returns the columns of the output file, -validate checks
+// the rows against it
+func (cfg *config) outputHeader() []string {
+	header := []string{"Id", "CreatedAt", "Body", "Sentiment", "Likes", "UserType", "SuspectTS"}
+	// rows are tagged with their stream filters only when scraping several
+	if len(cfg.filters) > 1 {
+		header = append(header, "SourceFilter")
+	}
+	// the interactions of the current user mean something only when logged in
+	if cfg.authenticated() {
+		header = append(header, "LikedByCurrentUser", "ResharedByCurrentUser")
+	}
+	if len(cfg.translateCmd) > 0 {
+		header = append(header, "TranslatedBody")
+	}
+	return header
+}
 
-	done.Wait()
+// summaryDate formats t for the -compact-summary line, - if no row was written
+func summaryDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02")
 }
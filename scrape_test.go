@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrapeEndsStreamNotSent(t *testing.T) {
+	quietLogger(t)
+	ts := httptest.NewServer(&benchServer{perPage: 5, pages: 2, start: time.Now().UTC()})
+	defer ts.Close()
+	cfg, err := defaultConfig(t).forFixture(t.TempDir(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// colly refuses the first poll, its URL was visited for the symbol page
+	cfg.initialURL = cfg.symbolPageURL(cfg.symbol)
+	done := make(chan error, 1)
+	go func() { done <- scrape(cfg) }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "cannot request") {
+			t.Fatalf("scrape = %v, want the request refused", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("scrape did not return once its only stream could not be sent")
+	}
+}
+
+func TestAPIErrorEnvelopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		err    string
+	}{
+		{"rate limit", `{"response":{"status":429}}`, 429, "API error status 429"},
+		{"rate limit with reason", `{"response":{"status":429},"errors":[{"message":"Rate limit exceeded"}]}`,
+			429, "API error status 429: Rate limit exceeded"},
+		{"auth", `{"response":{"status":401},"errors":[{"message":"Authentication required"},{"message":"Invalid csrf token"}]}`,
+			401, "API error status 401: Authentication required; Invalid csrf token"},
+		{"not found", `{"response":{"status":404},"errors":[{"message":"Symbol not found"}]}`,
+			404, "API error status 404: Symbol not found"},
+		{"reasons as strings", `{"response":{"status":403},"errors":["Forbidden"]}`, 403, "API error status 403: Forbidden"},
+		{"reasons without status", `{"errors":[{"message":"Something went wrong"}]}`, 0, "API error: Something went wrong"},
+		{"ok status", `{"response":{"status":200},"more":true,"messages":[{"id":1}]}`, 0, ""},
+		{"no envelope", `{"more":false,"messages":[]}`, 0, ""},
+		{"unknown response shape", `{"response":"ok","more":true,"messages":[]}`, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data Stream
+			if err := json.Unmarshal([]byte(tt.body), &data); err != nil {
+				t.Fatal(err)
+			}
+			status, err := data.apiError()
+			if status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("err = %v, want none", err)
+			case tt.err != "" && (err == nil || err.Error() != tt.err):
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAwaitBootstrap(t *testing.T) {
+	newInfos := func() *scrapeInfos {
+		return &scrapeInfos{csrfReady: make(chan error, 1), idReady: make(chan error, 1), pageReceived: make(chan struct{}, 1)}
+	}
+	closed := make(chan struct{})
+	close(closed)
+
+	t.Run("both extracted", func(t *testing.T) {
+		infos := newInfos()
+		infos.pageReceived <- struct{}{}
+		infos.csrfReady <- nil
+		infos.idReady <- nil
+		if err := infos.awaitBootstrap(make(chan struct{}), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("visit returned", func(t *testing.T) {
+		infos := newInfos()
+		infos.pageReceived <- struct{}{}
+		infos.csrfReady <- nil
+		err := infos.awaitBootstrap(closed, time.Minute)
+		if err == nil || err.Error() != "stream id not extracted from the symbol page" || exitCode(err) != exitSymbolNotFound {
+			t.Fatalf("got %v, want the stream id missing", err)
+		}
+	})
+	t.Run("extraction hangs", func(t *testing.T) {
+		infos := newInfos()
+		infos.pageReceived <- struct{}{}
+		infos.idReady <- nil
+		// the visit never returns
+		err := infos.awaitBootstrap(make(chan struct{}), 20*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "csrf token not extracted from the symbol page within 20ms") ||
+			exitCode(err) != exitSymbolNotFound {
+			t.Fatalf("got %v, want the csrf token timed out", err)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runSelftest scrapes a small canned stream from an in-process server and
+// checks that every message was written once, in order and sanitized
+func runSelftest(cfg *config) error {
+	dir, err := os.MkdirTemp("", "stockscraper-selftest")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	server := &benchServer{perPage: 7, pages: 3, start: time.Now().UTC()}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// nothing may be skipped or reordered, the fixture has no filters
+	testCfg, err := cfg.forFixture(dir, ts.URL)
+	if err != nil {
+		return err
+	}
+	if err := scrape(testCfg); err != nil {
+		return err
+	}
+
+	file, err := os.Open(testCfg.outputPath(".csv"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	// skips the #schema line
+	reader.Comment = '#'
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("output is not valid CSV: %s", err)
+	}
+	total := int(server.perPage * server.pages)
+	if len(rows) != total+1 {
+		return fmt.Errorf("want %d rows and a header, got %d lines", total, len(rows))
+	}
+	for i, row := range rows[1:] {
+		want := strconv.Itoa(total - i)
+		if row[0] != want {
+			return fmt.Errorf("row %d has id %s, want %s", i+1, row[0], want)
+		}
+		if body := benchBodies[(total-i)%len(benchBodies)]; row[2] != strings.ReplaceAll(strings.ReplaceAll(body, "\n", "\\n"), "\t", " ") {
+			return fmt.Errorf("row %d has body %q, want the sanitized %q", i+1, row[2], body)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import "time"
+
+// stocktwitsFounded is when StockTwits started, no message is older
+var stocktwitsFounded = time.Date(2008, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// futureTolerance is how far past the local clock a CreatedAt may be
+// before it is suspect, for clocks slightly apart
+const futureTolerance = 5 * time.Minute
+
+// suspectTime reports whether t cannot be when a message received at now
+// was created: it is in the future or before StockTwits existed
+func suspectTime(t, now time.Time) bool {
+	return t.After(now.Add(futureTolerance)) || t.Before(stocktwitsFounded)
+}
+
+// dateRun counts the messages of a stream older than -date in a row,
+// across pages, so that a single message from a skewed clock neither
+// stops the stream early nor keeps it going. Messages with a suspect
+// time are left out of the count.
+type dateRun struct {
+	older int
+}
+
+// observe counts msgs, newest first, received at now. It reports whether
+// need messages in a row are older than date and returns those with a
+// suspect time.
+func (d *dateRun) observe(msgs []Message, date, now time.Time, need int) (bool, []Message) {
+	var suspect []Message
+	reached := false
+	for _, msg := range msgs {
+		switch {
+		case suspectTime(msg.CreatedAt.Time, now):
+			suspect = append(suspect, msg)
+		case msg.CreatedAt.Before(date):
+			d.older++
+		default:
+			d.older = 0
+		}
+		if d.older >= need {
+			reached = true
+		}
+	}
+	return reached, suspect
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var (
+	skewNow  = time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	skewDate = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Timestamps of the adversarial sequences
+var (
+	newer  = skewDate.Add(time.Hour)
+	older  = skewDate.Add(-time.Hour)
+	future = skewNow.Add(3 * time.Hour)
+	epoch  = time.Unix(0, 0).UTC()
+)
+
+// dated returns a page of messages created at times, newest first as
+// the API sends them, with IDs counting down from 100
+func dated(times ...time.Time) []Message {
+	msgs := make([]Message, len(times))
+	for i, t := range times {
+		msgs[i].ID = int64(100 - i)
+		msgs[i].CreatedAt.Time = t
+	}
+	return msgs
+}
+
+func TestSuspectTime(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{skewNow, false},
+		{skewNow.Add(futureTolerance), false},
+		{skewNow.Add(futureTolerance + time.Second), true},
+		{future, true},
+		{stocktwitsFounded, false},
+		{stocktwitsFounded.Add(-time.Second), true},
+		{epoch, true},
+		{time.Time{}, true},
+		{older, false},
+	}
+	for _, tt := range tests {
+		if got := suspectTime(tt.t, skewNow); got != tt.want {
+			t.Errorf("suspectTime(%s) = %t, want %t", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestDateRunStopsOnConsecutiveOlderMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		// pages are observed in turn, the stop is checked after the last
+		pages   [][]Message
+		need    int
+		want    bool
+		suspect int
+	}{
+		{"all newer", [][]Message{dated(newer, newer, newer)}, 3, false, 0},
+		{"enough older", [][]Message{dated(newer, older, older, older)}, 3, true, 0},
+		{"a lone older message does not stop", [][]Message{dated(newer, older, newer, newer)}, 3, false, 0},
+		{"a newer message resets the run", [][]Message{dated(older, older, newer, older, older)}, 3, false, 0},
+		{"need 1 stops on the first older", [][]Message{dated(newer, older)}, 1, true, 0},
+		{"exactly the date is not older", [][]Message{dated(skewDate, skewDate, skewDate)}, 1, false, 0},
+		{"a future message neither counts nor resets",
+			[][]Message{dated(older, future, older, older)}, 3, true, 1},
+		{"a future message at the tail does not stop",
+			[][]Message{dated(newer, older, older, future)}, 3, false, 1},
+		{"messages before StockTwits are not older",
+			[][]Message{dated(epoch, epoch, epoch, time.Time{}, epoch)}, 3, false, 5},
+		{"suspect messages amid older ones",
+			[][]Message{dated(older, epoch, future, older, epoch, older)}, 3, true, 3},
+		{"the run spans pages",
+			[][]Message{dated(newer, older, older), dated(older, newer)}, 3, true, 0},
+		{"a page of suspect messages keeps the run",
+			[][]Message{dated(newer, older, older), dated(future, future), dated(older)}, 3, true, 2},
+		{"a newer message on the next page resets the run",
+			[][]Message{dated(older, older), dated(newer, older)}, 3, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var run dateRun
+			var reached bool
+			suspect := 0
+			for _, page := range tt.pages {
+				var s []Message
+				reached, s = run.observe(page, skewDate, skewNow, tt.need)
+				suspect += len(s)
+			}
+			if reached != tt.want || suspect != tt.suspect {
+				t.Fatalf("reached %t with %d suspect, want %t with %d", reached, suspect, tt.want, tt.suspect)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// decodeStream decodes a stream response from r into data with a
+// json.Decoder, skipping the fields it has no use for without holding them.
+// Each message is handed to keep as it is decoded and kept only if keep
+// returns true; once it returns false the rest of the messages are skipped
+// undecoded. It reports whether the response had messages or at least said
+// whether there are more, for -validate-response.
+func decodeStream(r io.Reader, data *Stream, keep func(*Message) bool) (bool, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return false, err
+	}
+	isStream := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+		switch tok {
+		case "more":
+			isStream = true
+			err = dec.Decode(&data.More)
+		case "since":
+			err = dec.Decode(&data.Since)
+		case "max":
+			err = dec.Decode(&data.Max)
+		case "messages":
+			var n int
+			n, err = decodeMessages(dec, data, keep)
+			isStream = isStream || n > 0
+		case "response":
+			err = dec.Decode(&data.Response)
+		case "errors":
+			err = dec.Decode(&data.Errors)
+		default:
+			err = skipValue(dec)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return isStream, expectDelim(dec, '}')
+}
+
+// decodeMessages decodes the messages array one message at a time, as
+// decodeStream describes, and returns the number of messages in it
+func decodeMessages(dec *json.Decoder, data *Stream, keep func(*Message) bool) (int, error) {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return 0, err
+	}
+	if tok != json.Delim('[') {
+		return 0, fmt.Errorf("want messages array, got %v", tok)
+	}
+	n, kept := 0, true
+	for ; dec.More(); n++ {
+		if !kept {
+			if err := skipValue(dec); err != nil {
+				return n, err
+			}
+			continue
+		}
+		var msg Message
+		if err := dec.Decode(&msg); err != nil {
+			return n, err
+		}
+		if kept = keep(&msg); kept {
+			data.Messages = append(data.Messages, msg)
+		}
+	}
+	return n, expectDelim(dec, ']')
+}
+
+// skipValue reads past the next value token by token
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("want %s, got %v", want, tok)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// streamBody is a stream response of n messages from ID n down to 1, with
+// fields the decoder skips
+func streamBody(t testing.TB, n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"cursor":{"more":true,"since":0},"messages":[`)
+	for id := n; id > 0; id-- {
+		msg := Message{ID: int64(id), Body: fmt.Sprintf("message %d $AAPL", id)}
+		msg.User.Username = "user"
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(data[:len(data)-1])
+		b.WriteString(`,"entities":{"chart":{"url":"https://charts.example/x.png"},"links":[1,2,3]}}`)
+		if id > 1 {
+			b.WriteByte(',')
+		}
+	}
+	b.WriteString(`],"more":true}`)
+	return b.Bytes()
+}
+
+func keepAll(*Message) bool { return true }
+
+func TestDecodeStream(t *testing.T) {
+	body := streamBody(t, 10)
+	var want Stream
+	if err := json.Unmarshal(body, &want); err != nil {
+		t.Fatal(err)
+	}
+	var got Stream
+	isStream, err := decodeStream(bytes.NewReader(body), &got, keepAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isStream || !got.More || len(got.Messages) != len(want.Messages) {
+		t.Fatalf("got isStream %t, more %t, %d messages, want true, true, %d", isStream, got.More, len(got.Messages), len(want.Messages))
+	}
+	for i := range want.Messages {
+		if got.Messages[i].ID != want.Messages[i].ID || got.Messages[i].Body != want.Messages[i].Body {
+			t.Fatalf("message %d = %+v, want %+v", i, got.Messages[i], want.Messages[i])
+		}
+	}
+
+	t.Run("stops at keep", func(t *testing.T) {
+		var got Stream
+		decoded := 0
+		isStream, err := decodeStream(bytes.NewReader(body), &got, func(msg *Message) bool {
+			decoded++
+			return msg.ID > 7
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// "more" after the skipped messages is still read
+		if !isStream || !got.More || len(got.Messages) != 3 || decoded != 4 {
+			t.Fatalf("got isStream %t, more %t, %d kept of %d decoded, want true, true, 3 of 4", isStream, got.More, len(got.Messages), decoded)
+		}
+	})
+
+	t.Run("not a stream", func(t *testing.T) {
+		var got Stream
+		isStream, err := decodeStream(bytes.NewReader([]byte(`{"response":{"status":401}}`)), &got, keepAll)
+		if err != nil || isStream {
+			t.Fatalf("got %t, %v, want false, nil", isStream, err)
+		}
+		if status, _ := got.apiError(); status != 401 {
+			t.Fatalf("envelope status %d, want 401", status)
+		}
+	})
+}
+
+// TestDecodeStreamAllocs checks that decoding costs the same per message
+// however large the page is: nothing but the kept messages grows with it.
+func TestDecodeStreamAllocs(t *testing.T) {
+	perMessage := func(n int) float64 {
+		body := streamBody(t, n)
+		allocs := testing.AllocsPerRun(5, func() {
+			var data Stream
+			if _, err := decodeStream(bytes.NewReader(body), &data, keepAll); err != nil {
+				t.Fatal(err)
+			}
+		})
+		return allocs / float64(n)
+	}
+	small, large := perMessage(10), perMessage(1000)
+	if large > small {
+		t.Fatalf("%.1f allocations per message for 1000 messages, more than the %.1f for 10", large, small)
+	}
+}
+
+func BenchmarkDecodeStream(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		body := streamBody(b, n)
+		b.Run(fmt.Sprintf("%d messages", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var data Stream
+				if _, err := decodeStream(bytes.NewReader(body), &data, keepAll); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(testing.AllocsPerRun(1, func() {
+				var data Stream
+				decodeStream(bytes.NewReader(body), &data, keepAll)
+			}))/float64(n), "allocs/message")
+		})
+	}
+}
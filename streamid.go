@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/gocolly/colly"
+)
+
+// Where the symbol page may keep its stream id, tried in order
+// after the ones given by -stream-id-selector and -stream-id-attr
+var (
+	streamIDSelectors  = []string{"ol.stream-list", "[data-stream-id]"}
+	streamIDAttributes = []string{"stream-id", "data-stream-id"}
+)
+
+// pageSelectors locate the CSRF token and the stream id in the symbol page
+type pageSelectors struct {
+	csrf         string
+	csrfAttr     string
+	streamID     []string
+	streamIDAttr []string
+}
+
+// newPageSelectors puts the given stream id selector and attribute ahead of the built-in ones
+func newPageSelectors(csrf, csrfAttr, streamID, streamIDAttr string) (pageSelectors, error) {
+	for _, sel := range []string{csrf, streamID} {
+		if _, err := cascadia.Compile(sel); err != nil {
+			return pageSelectors{}, fmt.Errorf("invalid selector %q: %s", sel, err)
+		}
+	}
+	s := pageSelectors{csrf: csrf, csrfAttr: csrfAttr}
+	s.streamID = append([]string{streamID}, streamIDSelectors...)
+	s.streamIDAttr = append([]string{streamIDAttr}, streamIDAttributes...)
+	return s, nil
+}
+
+// parseCSRFToken finds the CSRF token in the symbol page rooted at e
+func (s pageSelectors) parseCSRFToken(e *colly.HTMLElement) (string, error) {
+	node := e.DOM.Find(s.csrf).First()
+	if node.Length() == 0 {
+		return "", fmt.Errorf("csrf token not found in %s, no element matches %q", e.Request.URL, s.csrf)
+	}
+	token := strings.TrimSpace(node.AttrOr(s.csrfAttr, ""))
+	if token == "" {
+		return "", fmt.Errorf("csrf token not found in %s at %s[%s]", e.Request.URL, s.csrf, s.csrfAttr)
+	}
+	return token, nil
+}
+
+// parseStreamID finds the stream id in the symbol page rooted at e
+func (s pageSelectors) parseStreamID(e *colly.HTMLElement) (int, error) {
+	for _, sel := range s.streamID {
+		node := e.DOM.Find(sel).First()
+		if node.Length() == 0 {
+			continue
+		}
+		for _, attr := range s.streamIDAttr {
+			value, ok := node.Attr(attr)
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			id, err := strconv.Atoi(value)
+			if err != nil || id <= 0 {
+				return 0, fmt.Errorf("malformed stream id %q in %s at %s[%s]", value, e.Request.URL, sel, attr)
+			}
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("stream id not found in %s, tried selectors %q with attributes %q",
+		e.Request.URL, s.streamID, s.streamIDAttr)
+}
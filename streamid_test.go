@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+)
+
+// symbolPage returns the symbol page fixture body as colly hands it to
+// the OnHTML callbacks
+func symbolPage(t *testing.T, body string) *colly.HTMLElement {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+		`<html><head><meta name="csrf-token" content=" token "></head><body>` + body + `</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://stocktwits.com/symbol/AAPL")
+	return &colly.HTMLElement{DOM: doc.Selection, Request: &colly.Request{URL: u}}
+}
+
+func TestParseStreamID(t *testing.T) {
+	selectors, err := newPageSelectors("meta[name=csrf-token]", "content", "div.custom", "data-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		body string
+		want int
+		// err is part of the error, naming the page and the selector
+		err string
+	}{
+		{"plain", `<ol class="stream-list" stream-id="2044"></ol>`, 2044, ""},
+		{"whitespace", `<ol class="stream-list" stream-id=" 2044
+"></ol>`, 2044, ""},
+		{"custom selector first", `<div class="custom" data-id="7"></div><ol class="stream-list" stream-id="2044"></ol>`, 7, ""},
+		{"alternative attribute", `<ol class="stream-list" data-stream-id="2044"></ol>`, 2044, ""},
+		{"alternative selector", `<section data-stream-id="2044"></section>`, 2044, ""},
+		{"not a number", `<ol class="stream-list" stream-id="abc"></ol>`, 0,
+			`malformed stream id "abc" in https://stocktwits.com/symbol/AAPL at ol.stream-list[stream-id]`},
+		{"empty", `<ol class="stream-list" stream-id=""></ol>`, 0, `malformed stream id "" in`},
+		{"negative", `<ol class="stream-list" stream-id="-3"></ol>`, 0, `malformed stream id "-3"`},
+		{"float", `<ol class="stream-list" stream-id="20.44"></ol>`, 0, `malformed stream id "20.44"`},
+		{"missing attribute", `<ol class="stream-list"></ol>`, 0, "stream id not found in https://stocktwits.com/symbol/AAPL, tried selectors"},
+		{"missing element", `<ul></ul>`, 0, `"ol.stream-list"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := selectors.parseStreamID(symbolPage(t, tt.body))
+			if tt.err == "" {
+				if err != nil || id != tt.want {
+					t.Fatalf("parseStreamID = %d, %v, want %d", id, err, tt.want)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("parseStreamID = %d, %v, want an error containing %q", id, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseCSRFToken(t *testing.T) {
+	selectors, err := newPageSelectors("meta[name=csrf-token]", "content", "ol.stream-list", "stream-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := selectors.parseCSRFToken(symbolPage(t, "")); err != nil || token != "token" {
+		t.Fatalf("parseCSRFToken = %q, %v, want the trimmed token", token, err)
+	}
+	missing, _ := newPageSelectors("meta[name=csrf]", "content", "ol.stream-list", "stream-id")
+	if _, err := missing.parseCSRFToken(symbolPage(t, "")); err == nil || !strings.Contains(err.Error(), `"meta[name=csrf]"`) {
+		t.Fatalf("parseCSRFToken without the element = %v, want an error naming the selector", err)
+	}
+}
+
+func TestNewPageSelectorsRejectsInvalidSelector(t *testing.T) {
+	if _, err := newPageSelectors("meta[", "content", "ol.stream-list", "stream-id"); err == nil {
+		t.Fatal("newPageSelectors accepted an invalid selector")
+	}
+}
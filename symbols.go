@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// stocktwitsIndices maps the index notations of other sites to the StockTwits symbols
+var stocktwitsIndices = map[string]string{
+	"^GSPC": "SPX",
+	"^SPX":  "SPX",
+	"^DJI":  "DJIA",
+	"^NDX":  "NDX",
+	"^RUT":  "RUT",
+	"^VIX":  "VIX",
+}
+
+// stocktwitsSymbol returns the StockTwits spelling of symbol: known indices
+// are mapped and crypto pairs quoted in USD such as BTC-USD become BTC.X.
+// Anything else is kept, StockTwits has the foreign listings with their dots.
+func stocktwitsSymbol(symbol string) string {
+	upper := strings.ToUpper(symbol)
+	if s, ok := stocktwitsIndices[upper]; ok {
+		return s
+	}
+	if base := strings.TrimSuffix(upper, "-USD"); base != upper && base != "" {
+		return base + ".X"
+	}
+	return symbol
+}
+
+// pennyStockPattern matches the symbols that look like OTC or pink sheet
+// listings: the .OB and .PK suffixes, or five or more characters without
+// a period. It is a guess, share classes such as GOOGL match too.
+var pennyStockPattern = regexp.MustCompile(`\.(OB|PK)$|^[^.]{5,}$`)
+
+// looksLikePennyStock reports whether symbol matches pennyStockPattern
+func looksLikePennyStock(symbol string) bool {
+	return pennyStockPattern.MatchString(strings.ToUpper(stocktwitsSymbol(symbol)))
+}
+
+// checkPennyStocks warns of the symbols that look like penny stocks, and
+// reports false if one does under -strict-validate
+func checkPennyStocks(cfg *config, symbols []string) bool {
+	ok := true
+	for _, symbol := range symbols {
+		if !looksLikePennyStock(symbol) {
+			continue
+		}
+		if cfg.strictValidate {
+			logger.Printf("ERROR: %s\n", pennyStockMessage(symbol))
+			ok = false
+		} else {
+			logger.Printf("WARNING: %s\n", pennyStockMessage(symbol))
+		}
+	}
+	return ok
+}
+
+func pennyStockMessage(symbol string) string {
+	return symbol + " looks like an OTC or pink sheet symbol, penny stocks have few messages and mostly empty pages"
+}
+
+// canonicalSymbol returns the symbol of the page's canonical URL, the last
+// path segment of href
+func canonicalSymbol(href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil || u.Path == "" {
+		return "", false
+	}
+	symbol := path.Base(strings.TrimSuffix(u.Path, "/"))
+	return symbol, symbol != "." && symbol != "/"
+}
@@ -0,0 +1,55 @@
+package main
+
+import "strings"
+
+// taggedSymbols returns the symbols a message tags, upper-cased
+func (m *Message) taggedSymbols() []string {
+	symbols := make([]string, len(m.Symbols))
+	for i, s := range m.Symbols {
+		symbols[i] = strings.ToUpper(s.Symbol)
+	}
+	return symbols
+}
+
+// symbolFilter drops messages by the symbols they tag
+type symbolFilter struct {
+	// maxTagged drops messages tagging more symbols, a spam pattern, 0 to disable
+	maxTagged int
+	// exclude drops messages tagging any of these
+	exclude []string
+	// require drops messages tagging none of these, if set
+	require []string
+}
+
+// keep reports whether msg passes the filter
+func (f *symbolFilter) keep(msg *Message) bool {
+	tagged := msg.taggedSymbols()
+	if f.maxTagged > 0 && len(tagged) > f.maxTagged {
+		return false
+	}
+	for _, s := range tagged {
+		if containsString(f.exclude, s) {
+			return false
+		}
+	}
+	if len(f.require) == 0 {
+		return true
+	}
+	for _, s := range tagged {
+		if containsString(f.require, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSymbolList splits a comma separated list of symbols, upper-cased
+func parseSymbolList(s string) []string {
+	var symbols []string
+	for _, sym := range strings.Split(s, ",") {
+		if sym = strings.ToUpper(strings.TrimSpace(sym)); sym != "" {
+			symbols = append(symbols, sym)
+		}
+	}
+	return symbols
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// twelveSymbols are more than a spam cap would allow
+var twelveSymbols = strings.Split("AAPL,MSFT,GOOG,AMZN,META,NVDA,TSLA,AMD,INTC,NFLX,GME,AMC", ",")
+
+// taggingMessage returns a message tagging symbols, as the API lists them
+func taggingMessage(symbols ...string) *Message {
+	msg := &Message{ID: 1, Body: "fixture"}
+	for _, s := range symbols {
+		msg.Symbols = append(msg.Symbols, struct {
+			Symbol string `json:"symbol"`
+		}{s})
+	}
+	return msg
+}
+
+func TestSymbolFilterKeep(t *testing.T) {
+	none := taggingMessage()
+	one := taggingMessage("aapl")
+	twelve := taggingMessage(twelveSymbols...)
+	tests := []struct {
+		name   string
+		filter symbolFilter
+		keep   [3]bool // messages tagging 0, 1 and 12 symbols
+	}{
+		{"no filter", symbolFilter{}, [3]bool{true, true, true}},
+		{"cap at 5", symbolFilter{maxTagged: 5}, [3]bool{true, true, false}},
+		{"cap at 12 is inclusive", symbolFilter{maxTagged: 12}, [3]bool{true, true, true}},
+		{"cap at 11", symbolFilter{maxTagged: 11}, [3]bool{true, true, false}},
+		{"cap at 1", symbolFilter{maxTagged: 1}, [3]bool{true, true, false}},
+		{"exclude a meme ticker", symbolFilter{exclude: []string{"GME"}}, [3]bool{true, true, false}},
+		{"exclude the only tag", symbolFilter{exclude: []string{"AAPL"}}, [3]bool{true, false, false}},
+		{"exclude an untagged symbol", symbolFilter{exclude: []string{"SPY"}}, [3]bool{true, true, true}},
+		{"require a tag", symbolFilter{require: []string{"AAPL"}}, [3]bool{false, true, true}},
+		{"require any of several", symbolFilter{require: []string{"SPY", "AMC"}}, [3]bool{false, false, true}},
+		{"require and cap", symbolFilter{require: []string{"AAPL"}, maxTagged: 5}, [3]bool{false, true, false}},
+		{"require and exclude", symbolFilter{require: []string{"AAPL"}, exclude: []string{"TSLA"}}, [3]bool{false, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, msg := range []*Message{none, one, twelve} {
+				if got := tt.filter.keep(msg); got != tt.keep[i] {
+					t.Errorf("keep of a message tagging %d symbols = %t, want %t", len(msg.Symbols), got, tt.keep[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSymbolFilterFlags(t *testing.T) {
+	cfg := configWithArgs(t, "-max-tagged-symbols", "5", "-exclude-tagged", " gme, AMC ,", "-require-tagged", "aapl")
+	want := symbolFilter{maxTagged: 5, exclude: []string{"GME", "AMC"}, require: []string{"AAPL"}}
+	if fmt.Sprint(cfg.symbolFilter) != fmt.Sprint(want) {
+		t.Fatalf("symbolFilter = %+v, want %+v", cfg.symbolFilter, want)
+	}
+}
+
+// the filter expression sees the same tags, as a list
+func TestTaggedSymbolsInFilterExpr(t *testing.T) {
+	tests := []struct {
+		source string
+		keep   [3]bool
+	}{
+		{`len(tagged_symbols) <= 5`, [3]bool{true, true, false}},
+		{`"AAPL" in tagged_symbols`, [3]bool{false, true, true}},
+		{`"GME" not in tagged_symbols && len(tagged_symbols) > 0`, [3]bool{false, true, false}},
+	}
+	msgs := []*Message{taggingMessage(), taggingMessage("aapl"), taggingMessage(twelveSymbols...)}
+	for _, tt := range tests {
+		e, err := compileMessageExpr(tt.source)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.source, err)
+		}
+		for i, msg := range msgs {
+			if got, err := e.match(msg); err != nil || got != tt.keep[i] {
+				t.Errorf("%s on %d symbols = %t, %v, want %t", tt.source, len(msg.Symbols), got, err, tt.keep[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// stages of the pipeline every page goes through, in order
+const (
+	stageFetch = iota
+	stageParse
+	stageFilter
+	stageWrite
+	stageCount
+)
+
+var stageNames = [stageCount]string{"fetch", "parse", "filter", "write"}
+
+// timingEvery is how many pages of a stage there are per page timed
+const timingEvery = 8
+
+// stageTimings accumulates the time each stage spent and the messages it
+// handled. Only one page in every is timed, the others cost an atomic add
+// for their messages, cheap enough to always run; -timing only decides
+// whether the summary is logged. The time of the pages not timed is
+// estimated from those that were.
+type stageTimings struct {
+	every    int64
+	calls    [stageCount]atomic.Int64
+	timed    [stageCount]atomic.Int64
+	spent    [stageCount]atomic.Int64
+	messages [stageCount]atomic.Int64
+}
+
+// newStageTimings times one page in every of each stage, every page if every is 1
+func newStageTimings(every int64) *stageTimings {
+	return &stageTimings{every: every}
+}
+
+// stageTiming is the total of one stage recorded in the run metadata
+type stageTiming struct {
+	Nanos    int64 `json:"ns"`
+	Messages int64 `json:"messages"`
+}
+
+// stageClock times a page of a stage if it was sampled
+type stageClock struct {
+	timings *stageTimings
+	stage   int
+	start   time.Time
+}
+
+// begin starts a page of stage, reading the clock only if it is sampled
+func (t *stageTimings) begin(stage int) stageClock {
+	c := stageClock{timings: t, stage: stage}
+	if t.sampled(stage) {
+		c.start = time.Now()
+	}
+	return c
+}
+
+// end records the page begun as handling n messages
+func (c stageClock) end(n int) {
+	if !c.start.IsZero() {
+		c.timings.spent[c.stage].Add(int64(time.Since(c.start)))
+		c.timings.timed[c.stage].Add(1)
+	}
+	c.timings.messages[c.stage].Add(int64(n))
+}
+
+// span records a page of stage from start to end, times read anyway, as
+// a sampled page if it is one
+func (t *stageTimings) span(stage int, start, end time.Time, n int) {
+	if t.sampled(stage) {
+		t.spent[stage].Add(int64(end.Sub(start)))
+		t.timed[stage].Add(1)
+	}
+	t.messages[stage].Add(int64(n))
+}
+
+// sampled counts a page of stage and reports whether it is to be timed,
+// the first and then one in every
+func (t *stageTimings) sampled(stage int) bool {
+	n := t.calls[stage].Add(1)
+	return t.every <= 1 || n%t.every == 1
+}
+
+// estimate returns the time stage spent, that of the pages timed scaled
+// up to every page
+func (t *stageTimings) estimate(stage int) time.Duration {
+	timed := t.timed[stage].Load()
+	if timed == 0 {
+		return 0
+	}
+	return time.Duration(t.spent[stage].Load() * t.calls[stage].Load() / timed)
+}
+
+// totals returns the stages by name for the run metadata
+func (t *stageTimings) totals() map[string]stageTiming {
+	totals := map[string]stageTiming{}
+	for stage, name := range stageNames {
+		totals[name] = stageTiming{Nanos: int64(t.estimate(stage)), Messages: t.messages[stage].Load()}
+	}
+	return totals
+}
+
+// bottleneck returns the name of the stage that spent the most time, ""
+// before any was timed
+func (t *stageTimings) bottleneck() string {
+	slowest, most := "", time.Duration(0)
+	for stage, name := range stageNames {
+		if spent := t.estimate(stage); spent > most {
+			slowest, most = name, spent
+		}
+	}
+	return slowest
+}
+
+// summary returns one line per stage with its share of wall and its cost per
+// message, then the bottleneck. Filters poll concurrently, so the shares may
+// add up to more than 100%.
+func (t *stageTimings) summary(wall time.Duration) []string {
+	lines := make([]string, 0, stageCount+2)
+	var busy time.Duration
+	for stage, name := range stageNames {
+		spent := t.estimate(stage)
+		busy += spent
+		perMessage := time.Duration(0)
+		if n := t.messages[stage].Load(); n > 0 {
+			perMessage = spent / time.Duration(n)
+		}
+		lines = append(lines, fmt.Sprintf("%-6s %10s %5.1f%%, %s per message",
+			name, spent.Round(time.Microsecond), percentOf(spent, wall), perMessage))
+	}
+	other := wall - busy
+	if other < 0 {
+		other = 0
+	}
+	lines = append(lines, fmt.Sprintf("%-6s %10s %5.1f%%, delays, retries and pauses",
+		"other", other.Round(time.Microsecond), percentOf(other, wall)))
+	if slowest := t.bottleneck(); slowest != "" {
+		lines = append(lines, fmt.Sprintf("bottleneck: %s, timed 1 in %d pages", slowest, max(t.every, 1)))
+	}
+	return lines
+}
+
+func percentOf(d, wall time.Duration) float64 {
+	if wall <= 0 {
+		return 0
+	}
+	return 100 * float64(d) / float64(wall)
+}
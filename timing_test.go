@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowWriter is a sink taking delay for every write
+type slowWriter struct {
+	delay time.Duration
+}
+
+func (w slowWriter) Write(b []byte) (int, error) {
+	time.Sleep(w.delay)
+	return len(b), nil
+}
+
+// timePipeline runs pages of the benchmark's messages through the stages
+// as scrape does, the fetch taking fetchDelay and every write writeDelay
+func timePipeline(t *testing.T, pages int, fetchDelay, writeDelay time.Duration) *stageTimings {
+	timings := newStageTimings(4)
+	body, err := json.Marshal(map[string]interface{}{"messages": []map[string]interface{}{
+		{"id": 3, "body": benchBodies[0]}, {"id": 2, "body": benchBodies[1]}, {"id": 1, "body": benchBodies[2]},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := newRowWriter(slowWriter{writeDelay}, "minimal", false)
+	for page := 0; page < pages; page++ {
+		sent := time.Now()
+		time.Sleep(fetchDelay)
+		timings.span(stageFetch, sent, time.Now(), 3)
+
+		parse := timings.begin(stageParse)
+		var data Stream
+		if err := json.Unmarshal(body, &data); err != nil {
+			t.Fatal(err)
+		}
+		parse.end(len(data.Messages))
+
+		filtering := timings.begin(stageFilter)
+		kept := data.Messages[:0]
+		for _, msg := range data.Messages {
+			if msg.ID > 0 {
+				kept = append(kept, msg)
+			}
+		}
+		filtering.end(len(data.Messages))
+
+		writing := timings.begin(stageWrite)
+		for _, msg := range kept {
+			writer.Write([]string{strconv.FormatInt(msg.ID, 10), msg.Body})
+		}
+		writer.Flush()
+		writing.end(len(kept))
+	}
+	return timings
+}
+
+func TestTimingFindsSlowSink(t *testing.T) {
+	timings := timePipeline(t, 40, 0, 2*time.Millisecond)
+	if got := timings.bottleneck(); got != "write" {
+		t.Fatalf("bottleneck = %q with a slow sink, want write\n%s", got, strings.Join(timings.summary(time.Second), "\n"))
+	}
+	lines := timings.summary(time.Second)
+	if last := lines[len(lines)-1]; !strings.HasPrefix(last, "bottleneck: write") {
+		t.Fatalf("summary ends with %q, want the write bottleneck", last)
+	}
+	// 10 of the 40 pages were timed, the estimate covers them all
+	if got := timings.estimate(stageWrite); got < 40*2*time.Millisecond {
+		t.Fatalf("write estimated at %s, want at least the 80ms slept", got)
+	}
+	if n := timings.timed[stageWrite].Load(); n != 10 {
+		t.Fatalf("%d write pages timed, want 1 in 4 of 40", n)
+	}
+	if n := timings.totals()["write"].Messages; n != 120 {
+		t.Fatalf("%d messages written, want all 120 counted", n)
+	}
+}
+
+func TestTimingFindsSlowFetch(t *testing.T) {
+	timings := timePipeline(t, 20, 2*time.Millisecond, 0)
+	if got := timings.bottleneck(); got != "fetch" {
+		t.Fatalf("bottleneck = %q with a slow server, want fetch\n%s", got, strings.Join(timings.summary(time.Second), "\n"))
+	}
+}
+
+func TestTimingSamples(t *testing.T) {
+	timings := newStageTimings(8)
+	var sampled []int
+	for i := 1; i <= 20; i++ {
+		if timings.sampled(stageParse) {
+			sampled = append(sampled, i)
+		}
+	}
+	if want := []int{1, 9, 17}; !reflect.DeepEqual(sampled, want) {
+		t.Fatalf("sampled pages %v, want %v", sampled, want)
+	}
+	if bottleneck := newStageTimings(8).bottleneck(); bottleneck != "" {
+		t.Fatalf("bottleneck of nothing timed = %q", bottleneck)
+	}
+}
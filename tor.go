@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// torCircuitWait is how long Tor gets to build a circuit after NEWNYM
+const torCircuitWait = 5 * time.Second
+
+// torController asks Tor for a new circuit over its control port,
+// at most once per minInterval.
+type torController struct {
+	addr        string
+	password    string
+	minInterval time.Duration
+
+	mutex     sync.Mutex
+	last      time.Time
+	rotations int
+}
+
+// rotate signals NEWNYM and waits for the new circuit.
+// It returns false without error if the last rotation is too recent.
+func (t *torController) rotate() (bool, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.last.IsZero() && time.Since(t.last) < t.minInterval {
+		return false, nil
+	}
+	t.last = time.Now()
+	conn, err := net.DialTimeout("tcp", t.addr, 10*time.Second)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+	auth := "AUTHENTICATE"
+	if t.password != "" {
+		auth += fmt.Sprintf(" %q", t.password)
+	}
+	for _, cmd := range []string{auth, "SIGNAL NEWNYM"} {
+		if _, err := fmt.Fprintf(conn, "%s\r\n", cmd); err != nil {
+			return false, err
+		}
+		reply, err := r.ReadString('\n')
+		if err != nil {
+			return false, err
+		}
+		if !strings.HasPrefix(reply, "250") {
+			return false, fmt.Errorf("tor control port refused %s: %s", strings.Fields(cmd)[0], strings.TrimSpace(reply))
+		}
+	}
+	t.rotations++
+	time.Sleep(torCircuitWait)
+	return true, nil
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// translateTimeout bounds the -translate-cmd answers to a page
+const translateTimeout = time.Minute
+
+// scriptLanguages are the scripts telling a language on their own, kana
+// before Han so that Japanese is not taken for Chinese
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Hiragana, "ja"}, {unicode.Katakana, "ja"}, {unicode.Hangul, "ko"}, {unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"}, {unicode.Arabic, "ar"}, {unicode.Hebrew, "he"}, {unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"}, {unicode.Greek, "el"},
+}
+
+// stopwords are frequent function words of the languages written in Latin
+// script, English first so that it wins ties
+var stopwords = []struct {
+	lang  string
+	words map[string]bool
+}{
+	{"en", wordSet("the and is are to of in it this that for with on be will not you my what just")},
+	{"es", wordSet("el los las que y es por para con una muy pero está más del")},
+	{"pt", wordSet("o os que e não é um uma para com mais está muito mas do")},
+	{"fr", wordSet("le les des et est une pour pas que dans sur avec très mais du")},
+	{"de", wordSet("der die das und ist nicht ein eine zu mit auf für ich sehr aber")},
+	{"it", wordSet("il di che e è per non un una con sono molto ma del")},
+}
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// detectLanguage guesses the language of body, "" if it has no words.
+// Latin script is English unless another language's function words are
+// more frequent; cashtags, mentions and links are not words.
+func detectLanguage(body string) string {
+	counts := make([]int, len(scriptLanguages))
+	latin := 0
+	for _, r := range body {
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for i, s := range scriptLanguages {
+			if unicode.Is(s.script, r) {
+				counts[i]++
+				break
+			}
+		}
+	}
+	best, bestCount := "", latin
+	for i, s := range scriptLanguages {
+		// any kana makes it Japanese
+		if counts[i] > bestCount || (counts[i] > 0 && s.lang == "ja") {
+			best, bestCount = s.lang, counts[i]
+			if s.lang == "ja" {
+				break
+			}
+		}
+	}
+	if best != "" {
+		return best
+	}
+	hits := make([]int, len(stopwords))
+	words := 0
+	for _, w := range strings.Fields(strings.ToLower(body)) {
+		if strings.HasPrefix(w, "$") || strings.HasPrefix(w, "@") || strings.HasPrefix(w, "http") {
+			continue
+		}
+		w = strings.TrimFunc(w, func(r rune) bool { return !unicode.IsLetter(r) })
+		if w == "" {
+			continue
+		}
+		words++
+		for i, s := range stopwords {
+			if s.words[w] {
+				hits[i]++
+			}
+		}
+	}
+	if words == 0 {
+		return ""
+	}
+	lang := 0
+	for i := range hits {
+		if hits[i] > hits[lang] {
+			lang = i
+		}
+	}
+	return stopwords[lang].lang
+}
+
+// translateRequest and translateResponse are the JSON lines exchanged with
+// -translate-cmd, one response per request in the same order
+type translateRequest struct {
+	ID   int64  `json:"id"`
+	Lang string `json:"lang"`
+	Text string `json:"text"`
+}
+
+type translateResponse struct {
+	ID    int64  `json:"id"`
+	Text  string `json:"text"`
+	Error string `json:"error,omitempty"`
+}
+
+// Translator is the pluggable translation stage. Translate returns one
+// response per request in the same order, those received so far with the
+// error if it fails. A response carrying an error fails that body only.
+type Translator interface {
+	Translate(requests []translateRequest) ([]translateResponse, error)
+	Close() error
+}
+
+// translator fills the TranslatedBody column by sending the bodies of the
+// languages not skipped to a Translator, -translate-cmd by default.
+// Translations are appended to a cache keyed by the SHA-256 of the body so
+// that no body is sent twice, whatever the run. A Translator that fails is
+// not fatal: the rows keep an empty column and are counted as failed.
+type translator struct {
+	backend   Translator
+	skip      map[string]bool
+	cache     map[string]string
+	cacheFile *os.File
+	// broken stops sending to a backend that failed once
+	broken bool
+
+	translated, cached, failed int
+}
+
+// translateCacheEntry is a line of the SYMBOL.translations.jsonl cache
+type translateCacheEntry struct {
+	Hash string `json:"hash"`
+	Text string `json:"text"`
+}
+
+// openTranslator starts -translate-cmd args behind the cache cacheName
+func openTranslator(args, skip []string, cacheName string) (*translator, error) {
+	t, err := newTranslator(nil, skip, cacheName)
+	if err != nil {
+		return nil, err
+	}
+	if t.backend, err = startCommandTranslator(args); err != nil {
+		t.fail(err)
+	}
+	return t, nil
+}
+
+// newTranslator returns a translator sending to backend, nil until set
+func newTranslator(backend Translator, skip []string, cacheName string) (*translator, error) {
+	t := &translator{backend: backend, skip: map[string]bool{}, cache: map[string]string{}}
+	for _, lang := range skip {
+		t.skip[lang] = true
+	}
+	if data, err := os.ReadFile(cacheName); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			var entry translateCacheEntry
+			// a line cut by a crash is ignored
+			if json.Unmarshal([]byte(line), &entry) == nil && entry.Hash != "" {
+				t.cache[entry.Hash] = entry.Text
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	var err error
+	t.cacheFile, err = os.OpenFile(cacheName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// fail logs err and stops sending to the backend
+func (t *translator) fail(err error) {
+	logger.Printf("WARNING: -translate-cmd failed: %s, the rows left keep an empty TranslatedBody\n", err)
+	t.broken = true
+}
+
+// translate returns the translations of the bodies of msgs, "" for those
+// in a skipped language or whose translation failed
+func (t *translator) translate(msgs []taggedMessage) []string {
+	result := make([]string, len(msgs))
+	var pending []int
+	var requests []translateRequest
+	for i := range msgs {
+		msg := &msgs[i].Message
+		lang := detectLanguage(msg.Body)
+		if lang == "" || t.skip[lang] {
+			continue
+		}
+		if text, ok := t.cache[bodyHash(msg.Body)]; ok {
+			result[i] = text
+			t.cached++
+			continue
+		}
+		pending = append(pending, i)
+		requests = append(requests, translateRequest{ID: msg.ID, Lang: lang, Text: msg.Body})
+	}
+	if len(pending) == 0 {
+		return result
+	}
+	if t.broken {
+		t.failed += len(pending)
+		return result
+	}
+	responses, err := t.backend.Translate(requests)
+	if err != nil {
+		t.fail(err)
+	}
+	for n, i := range pending {
+		if n >= len(responses) || responses[n].Error != "" {
+			t.failed++
+			continue
+		}
+		result[i] = responses[n].Text
+		t.translated++
+		hash := bodyHash(msgs[i].Body)
+		t.cache[hash] = result[i]
+		line, _ := json.Marshal(translateCacheEntry{Hash: hash, Text: result[i]})
+		if _, err := t.cacheFile.Write(append(line, '\n')); err != nil {
+			logger.Printf("WARNING: cannot cache translation: %s\n", err)
+		}
+	}
+	return result
+}
+
+// Close ends the backend and closes the cache
+func (t *translator) Close() error {
+	if t.backend != nil {
+		t.backend.Close()
+	}
+	return t.cacheFile.Close()
+}
+
+// commandTranslator is the Translator of -translate-cmd, a long running
+// command reading translateRequest lines on stdin and answering
+// translateResponse lines on stdout
+type commandTranslator struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func startCommandTranslator(args []string) (*commandTranslator, error) {
+	t := &commandTranslator{cmd: exec.Command(args[0], args[1:]...)}
+	t.cmd.Stderr = os.Stderr
+	var err error
+	if t.stdin, err = t.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := t.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	t.stdout = bufio.NewReader(stdout)
+	if err := t.cmd.Start(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Translate sends requests to the command and reads as many responses,
+// killing the command if it fails
+func (t *commandTranslator) Translate(requests []translateRequest) ([]translateResponse, error) {
+	responses, err := t.exchange(requests)
+	if err != nil {
+		t.cmd.Process.Kill()
+	}
+	return responses, err
+}
+
+func (t *commandTranslator) exchange(requests []translateRequest) ([]translateResponse, error) {
+	// written while the responses are read, the command may answer before
+	// it has read everything and block on a full pipe
+	go func() {
+		enc := json.NewEncoder(t.stdin)
+		for _, req := range requests {
+			if enc.Encode(req) != nil {
+				return
+			}
+		}
+	}()
+	type outcome struct {
+		responses []translateResponse
+		err       error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		for _, req := range requests {
+			line, err := t.stdout.ReadBytes('\n')
+			if err != nil {
+				o.err = err
+				break
+			}
+			var res translateResponse
+			if err := json.Unmarshal(line, &res); err != nil {
+				o.err = fmt.Errorf("invalid response %q: %s", line, err)
+				break
+			}
+			if res.ID != req.ID {
+				o.err = fmt.Errorf("got the response for %d, want %d", res.ID, req.ID)
+				break
+			}
+			o.responses = append(o.responses, res)
+		}
+		done <- o
+	}()
+	select {
+	case o := <-done:
+		return o.responses, o.err
+	case <-time.After(translateTimeout):
+		// the kill makes the reader return
+		t.cmd.Process.Kill()
+		o := <-done
+		return o.responses, errors.New("no response within " + translateTimeout.String())
+	}
+}
+
+// Close closes stdin and waits for the command, killing it after 5s
+func (t *commandTranslator) Close() error {
+	t.stdin.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- t.cmd.Wait() }()
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(5 * time.Second):
+		t.cmd.Process.Kill()
+		return <-exited
+	}
+}
+
+func bodyHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
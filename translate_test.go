@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeTranslator prefixes each body with its language and records what it
+// was sent. It fails once failAfter requests were answered, if set.
+type fakeTranslator struct {
+	sent      []string
+	failAfter int
+	closed    bool
+}
+
+func (f *fakeTranslator) Translate(requests []translateRequest) ([]translateResponse, error) {
+	var responses []translateResponse
+	for _, req := range requests {
+		if f.failAfter > 0 && len(f.sent) >= f.failAfter {
+			return responses, errors.New("fake failure")
+		}
+		f.sent = append(f.sent, req.Text)
+		responses = append(responses, translateResponse{ID: req.ID, Text: req.Lang + ": " + req.Text})
+	}
+	return responses, nil
+}
+
+func (f *fakeTranslator) Close() error {
+	f.closed = true
+	return nil
+}
+
+func bodies(texts ...string) []taggedMessage {
+	msgs := make([]taggedMessage, len(texts))
+	for i, text := range texts {
+		msgs[i].ID = int64(i + 1)
+		msgs[i].Body = text
+	}
+	return msgs
+}
+
+func quietLogger(t testing.TB) {
+	saved := logger
+	logger = log.New(io.Discard, "", 0)
+	t.Cleanup(func() { logger = saved })
+}
+
+func TestTranslatorSkipsLanguagesAndCaches(t *testing.T) {
+	quietLogger(t)
+	cache := filepath.Join(t.TempDir(), "AAPL.translations.jsonl")
+	msgs := bodies("$AAPL is going to the moon, buy the dip", "株価が上がります", "Акции растут")
+
+	fake := &fakeTranslator{}
+	tr, err := newTranslator(fake, []string{"en"}, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "ja: 株価が上がります", "ru: Акции растут"}
+	if got := tr.translate(msgs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("translate = %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(fake.sent, []string{msgs[1].Body, msgs[2].Body}) {
+		t.Fatalf("sent %q, the skipped English body must not be sent", fake.sent)
+	}
+
+	// the same bodies again come from the cache
+	if got := tr.translate(msgs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("cached translate = %q, want %q", got, want)
+	}
+	if len(fake.sent) != 2 || tr.translated != 2 || tr.cached != 2 {
+		t.Fatalf("sent %d, translated %d, cached %d, want 2, 2, 2", len(fake.sent), tr.translated, tr.cached)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !fake.closed {
+		t.Fatal("Close did not close the backend")
+	}
+
+	// a new run reads the cache from disk
+	again := &fakeTranslator{}
+	tr, err = newTranslator(again, []string{"en"}, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	if got := tr.translate(msgs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("translate after reopening = %q, want %q", got, want)
+	}
+	if len(again.sent) != 0 {
+		t.Fatalf("sent %q after reopening, want everything cached", again.sent)
+	}
+}
+
+func TestTranslatorSkipList(t *testing.T) {
+	quietLogger(t)
+	fake := &fakeTranslator{}
+	tr, err := newTranslator(fake, []string{"en", "ja"}, filepath.Join(t.TempDir(), "cache.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	got := tr.translate(bodies("株価が上がります", "Акции растут", ""))
+	if want := []string{"", "ru: Акции растут", ""}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("translate = %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(fake.sent, []string{"Акции растут"}) {
+		t.Fatalf("sent %q, want only the Russian body", fake.sent)
+	}
+}
+
+func TestTranslatorFailureIsNotFatal(t *testing.T) {
+	quietLogger(t)
+	fake := &fakeTranslator{failAfter: 1}
+	tr, err := newTranslator(fake, []string{"en"}, filepath.Join(t.TempDir(), "cache.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	got := tr.translate(bodies("株価が上がります", "Акции растут"))
+	if want := []string{"ja: 株価が上がります", ""}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("translate = %q, want %q", got, want)
+	}
+	// a broken backend is not sent anything more
+	got = tr.translate(bodies("Ελληνικά κείμενα"))
+	if got[0] != "" || len(fake.sent) != 1 {
+		t.Fatalf("translate after failure = %q with %d sent, want empty and 1", got, len(fake.sent))
+	}
+	if tr.translated != 1 || tr.failed != 2 {
+		t.Fatalf("translated %d, failed %d, want 1 and 2", tr.translated, tr.failed)
+	}
+}
+
+func TestOpenTranslatorCacheFailure(t *testing.T) {
+	quietLogger(t)
+	// the cache is a directory, so it cannot be opened
+	if _, err := openTranslator([]string{"cat"}, nil, t.TempDir()); err == nil {
+		t.Fatal("openTranslator succeeded with a directory as cache")
+	}
+}
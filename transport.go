@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// streamRequestTimeout bounds each stream request, as colly's client timeout did
+const streamRequestTimeout = 10 * time.Second
+
+// timeoutTransport bounds every request, including the read of its body,
+// with a longer timeout for the symbol page, a full HTML document.
+type timeoutTransport struct {
+	base  http.RoundTripper
+	page  time.Duration
+	other time.Duration
+	// pages holds the URLs of symbol page requests, see markPage
+	pages sync.Map
+	// firstTTFB logs the time to first byte of the first response
+	firstTTFB sync.Once
+}
+
+// newTransport returns the collector's transport, proxied through tor if set
+func newTransport(cfg *config) (*timeoutTransport, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.ResponseHeaderTimeout = cfg.responseHeaderTimeout
+	if cfg.tor != "" {
+		proxy, err := url.Parse(cfg.tor)
+		if err != nil {
+			return nil, err
+		}
+		base.Proxy = http.ProxyURL(proxy)
+	}
+	return &timeoutTransport{base: base, page: cfg.pageVisitTimeout, other: streamRequestTimeout}, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := t.other
+	page := t.isPage(req)
+	if page {
+		timeout = t.page
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	sent := time.Now()
+	res, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("timed out after %s", timeout)
+		}
+		return nil, err
+	}
+	t.firstTTFB.Do(func() {
+		logger.Printf("time to first byte of %s: %s, see -response-header-timeout\n", req.URL, time.Since(sent).Round(time.Millisecond))
+	})
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// markPage marks the request for u as a symbol page, given the page timeout.
+// A stream path may share any prefix with the page path, so requests are not
+// told apart by their path.
+func (t *timeoutTransport) markPage(u *url.URL) {
+	t.pages.Store(u.String(), struct{}{})
+}
+
+// isPage reports whether req, or the request it was redirected from, was
+// marked by markPage
+func (t *timeoutTransport) isPage(req *http.Request) bool {
+	for {
+		if _, ok := t.pages.Load(req.URL.String()); ok {
+			return true
+		}
+		if req.Response == nil {
+			return false
+		}
+		req = req.Response.Request
+	}
+}
+
+// cancelBody releases the request's timeout once the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
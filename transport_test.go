@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransportPageTimeout(t *testing.T) {
+	quietLogger(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/AAPL" {
+			http.Redirect(w, r, "/AAPL/", http.StatusFound)
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "{}")
+	}))
+	defer ts.Close()
+	// the page path shares its prefix "/" with every stream path
+	cfg := configWithArgs(t, "-symbol-page-path", "/{{.Symbol}}", "-page-visit-timeout", "50ms", "-base-url", ts.URL)
+	transport, err := newTransport(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := url.Parse(cfg.symbolPageURL("AAPL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport.markPage(page)
+	client := &http.Client{Transport: transport}
+
+	// the redirected page request keeps the page timeout
+	if _, err := client.Get(page.String()); err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Fatalf("page request: %v, want a timeout after 50ms", err)
+	}
+	res, err := client.Get(cfg.buildStreamURL("AAPL", 686, 7, "all"))
+	if err != nil {
+		t.Fatalf("stream request: %s", err)
+	}
+	res.Body.Close()
+}
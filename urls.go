@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// defaultStreamURLTemplate is the StockTwits stream endpoint: the stream
+// head, or the page below .Max when set
+const defaultStreamURLTemplate = "/streams/{{if .Max}}poll{{else}}stream{{end}}" +
+	"?stream={{.Stream}}&stream_id={{.StreamID}}&substream={{.Substream}}&filter={{.Filter}}" +
+	"{{if .Max}}&max={{.Max}}{{else}}&username=undefined&symbol=undefined{{end}}"
+
+// conversationPagePath is the path of a message page without the message
+// ID, -conversation reads the CSRF token from the root message's page
+const conversationPagePath = "/message/"
+
+// pageURLData is what -symbol-page-path is rendered with
+type pageURLData struct {
+	// Symbol is escaped as a path segment
+	Symbol string
+}
+
+// streamURLData is what -stream-url-template is rendered with
+type streamURLData struct {
+	// Symbol is escaped as a path segment, Substream as a query value
+	Symbol    string
+	Stream    string
+	StreamID  int
+	Substream string
+	Filter    string
+	// Max is the ID below which to page, 0 for the stream head
+	Max int64
+}
+
+// parseURLTemplate parses a -symbol-page-path or -stream-url-template and
+// renders it once with sample so that unknown fields fail at startup
+func parseURLTemplate(name, text string, sample interface{}) (*template.Template, error) {
+	if !strings.HasPrefix(text, "/") {
+		return nil, fmt.Errorf("%s %q must start with /", name, text)
+	}
+	// the errors of the template package start with name already
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// renderURL renders t after base. The templates were executed once when
+// parsed, so they do not fail on the data they are given here.
+func renderURL(base string, t *template.Template, data interface{}) string {
+	var b strings.Builder
+	b.WriteString(base)
+	t.Execute(&b, data)
+	return b.String()
+}
+
+// symbolPageURL returns the URL of the symbol page, that of the root
+// message for -conversation
+func (cfg *config) symbolPageURL(symbol string) string {
+	if cfg.conversation != 0 {
+		return cfg.baseURL + conversationPagePath + strconv.FormatInt(cfg.conversation, 10)
+	}
+	return renderURL(cfg.baseURL, cfg.symbolPage, pageURLData{Symbol: url.PathEscape(symbol)})
+}
+
+// buildStreamURL returns the stream request of filter for the page below
+// max, the stream head if max is 0
+func (cfg *config) buildStreamURL(symbol string, streamID int, max int64, filter string) string {
+	return renderURL(cfg.baseURL, cfg.streamURL, streamURLData{
+		Symbol:    url.PathEscape(symbol),
+		Stream:    cfg.streamType,
+		StreamID:  streamID,
+		Substream: url.QueryEscape(cfg.substream),
+		Filter:    filter,
+		Max:       max,
+	})
+}
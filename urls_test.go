@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestBuildStreamURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		symbol string
+		max    int64
+		filter string
+		want   string
+	}{
+		{"initial", nil, "AAPL", 0, "all",
+			"https://stocktwits.com/streams/stream?stream=symbol&stream_id=686&substream=all&filter=all&username=undefined&symbol=undefined"},
+		{"paging below max", nil, "AAPL", 123456789, "all",
+			"https://stocktwits.com/streams/poll?stream=symbol&stream_id=686&substream=all&filter=all&max=123456789"},
+		{"suggested filter", nil, "AAPL", 500, "suggested",
+			"https://stocktwits.com/streams/poll?stream=symbol&stream_id=686&substream=all&filter=suggested&max=500"},
+		{"substream and stream type", []string{"-substream", "top picks", "-stream-type", "trending"}, "AAPL", 0, "all",
+			"https://stocktwits.com/streams/stream?stream=trending&stream_id=686&substream=top+picks&filter=all&username=undefined&symbol=undefined"},
+		{"conversation", []string{"-conversation", "42"}, "conversation-42", 0, "all",
+			"https://stocktwits.com/streams/stream?stream=conversation&stream_id=686&substream=all&filter=all&username=undefined&symbol=undefined"},
+		{"base url", []string{"-base-url", "http://127.0.0.1:8080/"}, "AAPL", 7, "all",
+			"http://127.0.0.1:8080/streams/poll?stream=symbol&stream_id=686&substream=all&filter=all&max=7"},
+		{"template", []string{"-stream-url-template", "/api/2/streams/symbol/{{.Symbol}}.json{{if .Max}}?max={{.Max}}{{end}}&filter={{.Filter}}"},
+			"BRK/B", 9, "suggested", "https://stocktwits.com/api/2/streams/symbol/BRK%2FB.json?max=9&filter=suggested"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := configWithArgs(t, tt.args...)
+			if got := cfg.buildStreamURL(tt.symbol, 686, tt.max, tt.filter); got != tt.want {
+				t.Fatalf("buildStreamURL = %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymbolPageURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		symbol string
+		want   string
+	}{
+		{"default", nil, "AAPL", "https://stocktwits.com/symbol/AAPL"},
+		{"prefix", []string{"-symbol-in-url-prefix", "/quote/"}, "AAPL", "https://stocktwits.com/quote/AAPL"},
+		{"page path", []string{"-symbol-page-path", "/v2/symbol/{{.Symbol}}/feed"}, "BRK.B", "https://stocktwits.com/v2/symbol/BRK.B/feed"},
+		{"escaped", nil, "A B/C", "https://stocktwits.com/symbol/A%20B%2FC"},
+		{"conversation", []string{"-conversation", "42"}, "conversation-42", "https://stocktwits.com/message/42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := configWithArgs(t, tt.args...).symbolPageURL(tt.symbol); got != tt.want {
+				t.Fatalf("symbolPageURL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validateShown is how many problems of each kind -validate logs
+const validateShown = 10
+
+// columnChecks parse the values of the output columns by name, the columns
+// without a check, such as Body, take any value
+var columnChecks = map[string]func(string) error{
+	"Id": func(v string) error {
+		if id, err := strconv.ParseInt(v, 10, 64); err != nil || id <= 0 {
+			return errors.New("not a positive integer")
+		}
+		return nil
+	},
+	"CreatedAt": func(v string) error {
+		_, err := time.Parse(time.RFC3339, v)
+		return err
+	},
+	"Likes": func(v string) error {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 {
+			return errors.New("not a non-negative integer")
+		}
+		return nil
+	},
+	"SuspectTS":             checkBool,
+	"LikedByCurrentUser":    checkBool,
+	"ResharedByCurrentUser": checkBool,
+}
+
+func checkBool(v string) error {
+	_, err := strconv.ParseBool(v)
+	return err
+}
+
+// validationReport is what -validate found in an output file. Structural
+// problems are rows that do not read as the header says; duplicates and
+// order breaks are anomalies of the data.
+type validationReport struct {
+	rows       int
+	structural []string
+	duplicates []string
+	// orderBreaks are rows newer than the row before, a resumed run or a
+	// -sort-order asc batch starts with one
+	orderBreaks []string
+	// counts of each kind, the lists above keep the first validateShown
+	structuralCount, duplicateCount, orderBreakCount int
+}
+
+func (r *validationReport) add(list *[]string, count *int, format string, args ...interface{}) {
+	*count++
+	if len(*list) < validateShown {
+		*list = append(*list, fmt.Sprintf(format, args...))
+	}
+}
+
+// validateOutput reads back the output file fName, checking that it starts
+// with header and that every row has its columns, parseable, and telling
+// duplicate IDs and rows out of the newest first order
+func validateOutput(fName string, header []string) (*validationReport, error) {
+	file, err := os.Open(fName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	// skips the #schema line
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	report := &validationReport{}
+	seen := map[string]int{}
+	var prev int64
+	for first := true; ; first = false {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the reader cannot tell where the next row starts
+			report.add(&report.structural, &report.structuralCount, "%s, rows after it not checked", err)
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if first {
+			if strings.Join(row, "\t") != strings.Join(header, "\t") {
+				report.add(&report.structural, &report.structuralCount, "line %d: header %q, want %q", line, row, header)
+			}
+			continue
+		}
+		report.rows++
+		if len(row) != len(header) {
+			report.add(&report.structural, &report.structuralCount, "line %d: %d columns, want %d", line, len(row), len(header))
+			continue
+		}
+		valid := true
+		for i, name := range header {
+			if check := columnChecks[name]; check != nil {
+				if err := check(row[i]); err != nil {
+					report.add(&report.structural, &report.structuralCount, "line %d: %s %q: %s", line, name, row[i], err)
+					valid = false
+				}
+			}
+		}
+		if !valid {
+			continue
+		}
+		if earlier, ok := seen[row[0]]; ok {
+			report.add(&report.duplicates, &report.duplicateCount, "line %d: Id %s already on line %d", line, row[0], earlier)
+			continue
+		}
+		seen[row[0]] = line
+		id, _ := strconv.ParseInt(row[0], 10, 64)
+		if prev != 0 && id > prev {
+			report.add(&report.orderBreaks, &report.orderBreakCount, "line %d: Id %d after %d", line, id, prev)
+		}
+		prev = id
+	}
+	return report, nil
+}
+
+// log logs the problems found in fName and a summary
+func (r *validationReport) log(fName string) {
+	for _, problem := range r.structural {
+		logger.Printf("ERROR: %s: %s\n", fName, problem)
+	}
+	for _, problem := range r.duplicates {
+		logger.Printf("WARNING: %s: duplicate %s\n", fName, problem)
+	}
+	for _, problem := range r.orderBreaks {
+		logger.Printf("%s: order break at %s\n", fName, problem)
+	}
+	logger.Printf("validated %d rows of %s: %d structural problems, %d duplicate IDs, %d order breaks\n",
+		r.rows, fName, r.structuralCount, r.duplicateCount, r.orderBreakCount)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// watchlistFormats maps an -import-format to the header names of its ticker
+// column, tried in order. generic falls back to guessing the column.
+var watchlistFormats = map[string][]string{
+	"generic":  {"symbol", "ticker"},
+	"fidelity": {"symbol"},
+	"ibkr":     {"symbol", "financial instrument"},
+}
+
+// exchangeSuffixes are the listing suffixes stripped from imported tickers,
+// e.g. SHOP.TO. Share class suffixes such as BRK.B are kept.
+var exchangeSuffixes = []string{"TO", "V", "CN", "NE", "L", "DE", "PA", "AS", "SW", "AX", "HK", "T"}
+
+// tickerPattern matches what a ticker cell looks like once cleaned
+var tickerPattern = regexp.MustCompile(`^[A-Z][A-Z0-9]{0,5}(\.[A-Z]{1,2})?$`)
+
+// importWatchlist reads the deduplicated tickers of a brokerage export,
+// in the order they first appear.
+func importWatchlist(name, format string) ([]string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		rows = append(rows, row)
+	}
+	// Excel saves a BOM before the first header
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+	}
+	header, col := findTickerColumn(rows, watchlistFormats[format])
+	if col < 0 && format == "generic" {
+		header, col = guessTickerColumn(rows)
+	}
+	if col < 0 {
+		return nil, fmt.Errorf("%s: no ticker column found for format %s", name, format)
+	}
+	var symbols []string
+	for _, row := range rows[header+1:] {
+		if col >= len(row) {
+			continue
+		}
+		symbol, ok := cleanTicker(row[col])
+		if ok && !containsString(symbols, symbol) {
+			symbols = append(symbols, symbol)
+		}
+	}
+	if len(symbols) == 0 {
+		return nil, errors.New(name + ": no tickers found")
+	}
+	return symbols, nil
+}
+
+// findTickerColumn returns the header row and the column named like one of names.
+// Exports may start with a preamble, so the header is searched for.
+func findTickerColumn(rows [][]string, names []string) (int, int) {
+	for _, name := range names {
+		for r, row := range rows {
+			for c, cell := range row {
+				if strings.EqualFold(strings.TrimSpace(cell), name) {
+					return r, c
+				}
+			}
+		}
+	}
+	return -1, -1
+}
+
+// guessTickerColumn picks the column where most cells below the first row look like tickers
+func guessTickerColumn(rows [][]string) (int, int) {
+	if len(rows) < 2 {
+		return -1, -1
+	}
+	best, bestCount := -1, 0
+	for c := range rows[0] {
+		count := 0
+		for _, row := range rows[1:] {
+			// tickers are exported upper-case, names and descriptions rarely are
+			if c < len(row) && row[c] == strings.ToUpper(row[c]) {
+				if _, ok := cleanTicker(row[c]); ok {
+					count++
+				}
+			}
+		}
+		if count > bestCount && count*2 >= len(rows)-1 {
+			best, bestCount = c, count
+		}
+	}
+	return 0, best
+}
+
+// cleanTicker upper-cases a cell and strips exchange suffixes.
+// It reports whether the result is a ticker; cash positions such as
+// Fidelity's SPAXX** are not.
+func cleanTicker(cell string) (string, bool) {
+	s := strings.ToUpper(strings.TrimSpace(cell))
+	if strings.HasSuffix(s, "**") {
+		return "", false
+	}
+	if i := strings.LastIndexByte(s, '.'); i > 0 && containsString(exchangeSuffixes, s[i+1:]) {
+		s = s[:i]
+	}
+	return s, tickerPattern.MatchString(s)
+}
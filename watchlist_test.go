@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fidelityExport is a Fidelity positions export, with a cash position and
+// the disclaimer rows it ends with
+const fidelityExport = `Account Number,Account Name,Symbol,Description,Quantity,Last Price
+Z12345678,Individual,AAPL,APPLE INC,10,$190.00
+Z12345678,Individual,SHOP.TO,SHOPIFY INC,5,$100.00
+Z12345678,Individual,SPAXX**,HELD IN MONEY MARKET,,
+Z87654321,Roth IRA,aapl,APPLE INC,1,$190.00
+
+"The data and information in this spreadsheet is provided to you solely for your use."
+`
+
+// ibkrExport is an IBKR portfolio export after its preamble, naming the
+// ticker column Financial Instrument
+const ibkrExport = `Portfolio
+Account,U1234567
+Financial Instrument,Position,Currency,Market Value
+MSFT,10,USD,4200
+BRK.B,3,USD,1200
+RY.TO,20,CAD,2800
+`
+
+// genericExport names no column after a ticker
+const genericExport = `Name,Code,Weight
+Apple,AAPL,0.5
+Microsoft,MSFT,0.3
+Tesla,TSLA,0.2
+`
+
+func writeWatchlist(t *testing.T, content string) string {
+	name := filepath.Join(t.TempDir(), "export.csv")
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestImportWatchlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    []string
+	}{
+		{"fidelity", "fidelity", fidelityExport, []string{"AAPL", "SHOP"}},
+		{"ibkr", "ibkr", ibkrExport, []string{"MSFT", "BRK.B", "RY"}},
+		{"generic by header", "generic", ibkrExport, []string{"MSFT", "BRK.B", "RY"}},
+		{"generic guessed", "generic", genericExport, []string{"AAPL", "MSFT", "TSLA"}},
+		{"BOM and CRLF", "fidelity", "\ufeff" + strings.ReplaceAll("Symbol,Description\nNVDA,NVIDIA CORP\nAMD,ADVANCED MICRO\n", "\n", "\r\n"),
+			[]string{"NVDA", "AMD"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := importWatchlist(writeWatchlist(t, tt.content), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("importWatchlist = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportWatchlistMalformedHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+	}{
+		{"fidelity without a Symbol column", "fidelity", "Account Number,Ticker Name,Description\nZ1,AAPL,APPLE INC\n"},
+		{"ibkr header only", "ibkr", "Financial Instrument,Position\n"},
+		{"generic without tickers", "generic", "Name,Description\nApple,iPhone maker\nMicrosoft,Windows maker\n"},
+		{"unterminated quote", "generic", "Symbol,\"Description\nAAPL,APPLE INC\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := importWatchlist(writeWatchlist(t, tt.content), tt.format); err == nil {
+				t.Fatalf("importWatchlist = %q, want an error", got)
+			}
+		})
+	}
+}